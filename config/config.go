@@ -1,6 +1,52 @@
 package config
 
-import "path/filepath"
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
+	"time"
+
+	"vern_kv/ratelimit"
+)
+
+// PrefixExtractor maps a key to its prefix.
+// The returned slice must be a prefix of key (the whole key is allowed).
+type PrefixExtractor func(key []byte) []byte
+
+// Comparator defines the key order.
+// Name is persisted with the data; a database must always be opened with a
+// comparator of the same name.
+type Comparator interface {
+	// Compare returns <0, 0 or >0 as a sorts before, equal to or after b.
+	Compare(a, b []byte) int
+
+	// Name identifies the ordering.
+	Name() string
+}
+
+// BytewiseComparator orders keys lexicographically by bytes (the default).
+var BytewiseComparator Comparator = bytewiseComparator{}
+
+type bytewiseComparator struct{}
+
+func (bytewiseComparator) Compare(a, b []byte) int { return bytes.Compare(a, b) }
+func (bytewiseComparator) Name() string            { return "vern.BytewiseComparator" }
+
+// MergeOperator folds operands written with Engine.Merge.
+type MergeOperator interface {
+	// Name identifies the operator.
+	Name() string
+
+	// FullMerge applies operands (oldest first) to the existing value,
+	// which is nil when the key is absent or deleted.
+	FullMerge(key, existing []byte, operands [][]byte) []byte
+
+	// PartialMerge combines two adjacent operands (left is older) into one.
+	// ok=false keeps both operands.
+	PartialMerge(key, left, right []byte) (merged []byte, ok bool)
+}
 
 // Config holds all tunable parameters for TectonKV.
 type Config struct {
@@ -9,6 +55,193 @@ type Config struct {
 
 	// Maximum size of the Memtable in bytes before flush
 	MemtableSizeBytes int64
+
+	// Optional prefix extractor used to build prefix filters for
+	// memtables and SSTables (nil disables prefix filters)
+	PrefixExtractor PrefixExtractor
+
+	// How long a pessimistic transaction waits for a key lock
+	// (0 means DefaultLockTimeout)
+	LockTimeout time.Duration
+
+	// Optional operator for Engine.Merge (nil disables merges)
+	MergeOperator MergeOperator
+
+	// Clock used for TTL expiry (nil means time.Now)
+	Clock func() time.Time
+
+	// Key order (nil means BytewiseComparator)
+	Comparator Comparator
+
+	// Options for named column families, filling the zero fields of the
+	// options passed to CreateColumnFamily. Open resolves them the same way
+	// from the options recorded at creation; PrefixExtractor and
+	// MergeOperator are not recorded, so they must be configured here (or
+	// in the defaults) to survive a restart
+	ColumnFamilies map[string]ColumnFamilyOptions
+
+	// Enables extra consistency checks, such as reporting SingleDelete misuse
+	Debug bool
+
+	// Largest accepted key and value (or merge operand) in bytes (0 means
+	// DefaultMaxKeySize and DefaultMaxValueSize). Recovery treats longer
+	// records as corruption, so a limit must not be lowered below data
+	// already written. Values folded by a merge operator may grow past
+	// MaxValueSize in SSTables.
+	MaxKeySize   int
+	MaxValueSize int
+
+	// Flush the memtables to SSTables on Engine.Close
+	FlushOnClose bool
+
+	// Collect counters and latency histograms, read with Engine.Stats
+	Statistics bool
+
+	// Optional listener notified of flushes, table files and errors
+	EventListener EventListener
+
+	// Destination of the engine log (nil means a JSON log in the rotating
+	// LOG file of DataDir; read-only engines then log nothing)
+	Logger *slog.Logger
+
+	// Optional limiter of disk writes, possibly shared by several engines:
+	// SSTable writes wait for it (without blocking reads and writes), WAL
+	// appends are charged to it, and read latencies tune an auto-tuned one
+	RateLimiter *ratelimit.RateLimiter
+
+	// Thresholds above which writes are delayed, then stopped
+	WriteStall WriteStallOptions
+}
+
+// WriteStallOptions throttles writes while persistence falls behind.
+// Past a Slowdown threshold each write is delayed, in proportion to how
+// close the value is to the Stop threshold; past a Stop threshold writes
+// wait until the value drops. A throttled write starts background work that
+// lowers the values: the frozen memtables are written and the SSTables
+// compacted. Zero thresholds are disabled.
+type WriteStallOptions struct {
+	// frozen memtables not yet written to an SSTable
+	SlowdownImmutableMemtables int
+	StopImmutableMemtables     int
+
+	// SSTables of a column family; they all sit in level 0 until compacted.
+	// A compaction leaves one table, so StopL0Tables 1 acts as 2.
+	SlowdownL0Tables int
+	StopL0Tables     int
+
+	// bytes of SSTables a compaction would rewrite
+	SlowdownPendingBytes int64
+	StopPendingBytes     int64
+
+	// delay of a write at a Stop threshold (0 means 100ms)
+	MaxDelay time.Duration
+}
+
+// Enabled reports whether any threshold is set.
+func (o WriteStallOptions) Enabled() bool {
+	return o.SlowdownImmutableMemtables > 0 || o.StopImmutableMemtables > 0 ||
+		o.SlowdownL0Tables > 0 || o.StopL0Tables > 0 ||
+		o.SlowdownPendingBytes > 0 || o.StopPendingBytes > 0
+}
+
+// returns MaxDelay, or its default when unset.
+func (o WriteStallOptions) MaxDelayOrDefault() time.Duration {
+	if o.MaxDelay > 0 {
+		return o.MaxDelay
+	}
+	return 100 * time.Millisecond
+}
+
+// DefaultLockTimeout is the key lock wait of a zero Config.LockTimeout.
+const DefaultLockTimeout = time.Second
+
+// returns LockTimeout, or DefaultLockTimeout when unset.
+func (c Config) LockTimeoutOrDefault() time.Duration {
+	if c.LockTimeout > 0 {
+		return c.LockTimeout
+	}
+	return DefaultLockTimeout
+}
+
+const (
+	DefaultMaxKeySize   = 64 << 10 // 64KB
+	DefaultMaxValueSize = 64 << 20 // 64MB
+
+	// lengths are stored as uint32
+	maxEncodedSize = math.MaxUint32
+)
+
+// KeySizeLimit returns the effective MaxKeySize.
+func (c Config) KeySizeLimit() int {
+	return sizeLimit(c.MaxKeySize, DefaultMaxKeySize)
+}
+
+// ValueSizeLimit returns the effective MaxValueSize.
+func (c Config) ValueSizeLimit() int {
+	return sizeLimit(c.MaxValueSize, DefaultMaxValueSize)
+}
+
+func sizeLimit(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return int(min(int64(n), maxEncodedSize))
+}
+
+// ColumnFamilyOptions tunes a single column family.
+// Zero fields inherit the corresponding Config value.
+type ColumnFamilyOptions struct {
+	MemtableSizeBytes int64
+	PrefixExtractor   PrefixExtractor
+	MergeOperator     MergeOperator
+}
+
+// returns Comparator, or BytewiseComparator when unset.
+func (c Config) KeyComparator() Comparator {
+	if c.Comparator != nil {
+		return c.Comparator
+	}
+	return BytewiseComparator
+}
+
+// returns the options of the default column family.
+func (c Config) DefaultColumnFamilyOptions() ColumnFamilyOptions {
+	return ColumnFamilyOptions{
+		MemtableSizeBytes: c.MemtableSizeBytes,
+		PrefixExtractor:   c.PrefixExtractor,
+		MergeOperator:     c.MergeOperator,
+	}
+}
+
+// returns opts with zero fields filled from the default column family.
+func (c Config) ResolveColumnFamilyOptions(opts ColumnFamilyOptions) ColumnFamilyOptions {
+	def := c.DefaultColumnFamilyOptions()
+	if opts.MemtableSizeBytes == 0 {
+		opts.MemtableSizeBytes = def.MemtableSizeBytes
+	}
+	if opts.PrefixExtractor == nil {
+		opts.PrefixExtractor = def.PrefixExtractor
+	}
+	if opts.MergeOperator == nil {
+		opts.MergeOperator = def.MergeOperator
+	}
+	return opts
+}
+
+// returns opts with zero fields filled from ColumnFamilies[name], then
+// from the default column family.
+func (c Config) ColumnFamilyOptionsFor(name string, opts ColumnFamilyOptions) ColumnFamilyOptions {
+	named := c.ColumnFamilies[name]
+	if opts.MemtableSizeBytes == 0 {
+		opts.MemtableSizeBytes = named.MemtableSizeBytes
+	}
+	if opts.PrefixExtractor == nil {
+		opts.PrefixExtractor = named.PrefixExtractor
+	}
+	if opts.MergeOperator == nil {
+		opts.MergeOperator = named.MergeOperator
+	}
+	return c.ResolveColumnFamilyOptions(opts)
 }
 
 // returns a safe default configuration.
@@ -16,9 +249,18 @@ func DefaultConfig(dataDir string) Config {
 	return Config{
 		DataDir:           dataDir,
 		MemtableSizeBytes: 2 * 1024 * 1024, // 2MB (default)
+		LockTimeout:       DefaultLockTimeout,
 	}
 }
 
+// returns the current time from Clock (or time.Now).
+func (c Config) Now() time.Time {
+	if c.Clock != nil {
+		return c.Clock()
+	}
+	return time.Now()
+}
+
 // returns the directory for WAL files.
 func (c Config) WALDir() string {
 	return filepath.Join(c.DataDir, "wal")
@@ -28,3 +270,37 @@ func (c Config) WALDir() string {
 func (c Config) SSTableDir() string {
 	return filepath.Join(c.DataDir, "sstables")
 }
+
+// returns the SSTable directory of a non-default column family.
+func (c Config) ColumnFamilyDir(id uint32) string {
+	return filepath.Join(c.DataDir, "cf", fmt.Sprintf("%d", id))
+}
+
+// FixedPrefix returns an extractor that uses the first n bytes of a key.
+// Keys shorter than n are their own prefix.
+func FixedPrefix(n int) PrefixExtractor {
+	return func(key []byte) []byte {
+		if len(key) <= n {
+			return key
+		}
+		return key[:n]
+	}
+}
+
+// DelimitedPrefix returns an extractor that cuts a key after the n-th
+// occurrence of sep, e.g. DelimitedPrefix('/', 2) maps
+// "tenant/42/orders/7" to "tenant/42/".
+// Keys with fewer than n separators are their own prefix.
+func DelimitedPrefix(sep byte, n int) PrefixExtractor {
+	return func(key []byte) []byte {
+		off := 0
+		for i := 0; i < n; i++ {
+			j := bytes.IndexByte(key[off:], sep)
+			if j < 0 {
+				return key
+			}
+			off += j + 1
+		}
+		return key[:off]
+	}
+}
@@ -0,0 +1,86 @@
+package config
+
+// EventListener is notified of engine activity.
+//
+// Callbacks run one at a time, in event order, on a goroutine of the
+// engine that holds no engine lock: they may call back into the engine,
+// and a slow listener delays later callbacks but never writes. The one
+// exception is Engine.Close, which delivers the pending events before it
+// returns and so would wait forever on the callback calling it.
+// Embed NoopEventListener to implement only some of them.
+type EventListener interface {
+	// a memtable is about to be written to an SSTable (Path is empty)
+	OnFlushBegin(info FlushInfo)
+	// the memtable is persisted in info.Path
+	OnFlushCompleted(info FlushInfo)
+
+	// an SSTable was written by a flush or a compaction
+	OnTableFileCreated(info TableFileInfo)
+	// an SSTable was deleted by a compaction or a dropped column family,
+	// or at Open as the leftover of an interrupted compaction
+	OnTableFileDeleted(info TableFileInfo)
+
+	// background work, such as a Flush(false), failed
+	OnBackgroundError(err error)
+
+	// the write stall condition of a column family changed
+	// (see Config.WriteStall)
+	OnWriteStall(info WriteStallInfo)
+}
+
+// FlushInfo describes a memtable flush.
+type FlushInfo struct {
+	ColumnFamily string
+	Path         string
+	Entries      int
+
+	// sequence range of the flushed entries and range tombstones
+	MinSeq uint64
+	MaxSeq uint64
+}
+
+// TableFileInfo describes an SSTable file.
+type TableFileInfo struct {
+	ColumnFamily string
+	Path         string
+
+	// file size in bytes (0 for deleted files)
+	Size int64
+}
+
+// WriteStallCondition tells how writes to a column family are throttled.
+type WriteStallCondition int
+
+const (
+	WriteStallNormal WriteStallCondition = iota
+	WriteStallDelayed
+	WriteStallStopped
+)
+
+func (c WriteStallCondition) String() string {
+	switch c {
+	case WriteStallDelayed:
+		return "delayed"
+	case WriteStallStopped:
+		return "stopped"
+	default:
+		return "normal"
+	}
+}
+
+// WriteStallInfo describes a change of write stall condition.
+type WriteStallInfo struct {
+	ColumnFamily string
+	Prev         WriteStallCondition
+	Cur          WriteStallCondition
+}
+
+// NoopEventListener ignores every event.
+type NoopEventListener struct{}
+
+func (NoopEventListener) OnFlushBegin(FlushInfo)           {}
+func (NoopEventListener) OnFlushCompleted(FlushInfo)       {}
+func (NoopEventListener) OnTableFileCreated(TableFileInfo) {}
+func (NoopEventListener) OnTableFileDeleted(TableFileInfo) {}
+func (NoopEventListener) OnBackgroundError(error)          {}
+func (NoopEventListener) OnWriteStall(WriteStallInfo)      {}
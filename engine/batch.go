@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"slices"
+
+	"vern_kv/wal"
+)
+
+// Batch collects writes that Engine.Write applies atomically.
+type Batch struct {
+	entries []wal.Entry
+
+	// column families written, checked by Engine.Write
+	cfs []*ColumnFamily
+	// first invalid write, returned by Engine.Write
+	err error
+}
+
+// creates an empty Batch.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Put adds a PUT to the batch. key and value are copied.
+func (b *Batch) Put(key, value []byte) {
+	b.entries = append(b.entries, wal.Entry{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), value...),
+	})
+}
+
+// Delete adds a DELETE (tombstone) to the batch. key is copied.
+func (b *Batch) Delete(key []byte) {
+	b.entries = append(b.entries, wal.Entry{
+		Key:       append([]byte(nil), key...),
+		Tombstone: true,
+	})
+}
+
+// Merge adds a MERGE operand to the batch. key and operand are copied.
+// Engine.Write fails with ErrNoMergeOperator if none is configured.
+func (b *Batch) Merge(key, operand []byte) {
+	b.entries = append(b.entries, wal.Entry{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), operand...),
+		Merge: true,
+	})
+}
+
+// PutCF adds a PUT in column family cf to the batch.
+// A nil cf makes Engine.Write fail with ErrColumnFamilyDropped.
+func (b *Batch) PutCF(cf *ColumnFamily, key, value []byte) {
+	if b.useCF(cf) {
+		b.Put(key, value)
+		b.entries[len(b.entries)-1].CF = cf.id
+	}
+}
+
+// MergeCF adds a MERGE operand in column family cf to the batch.
+// A nil cf makes Engine.Write fail with ErrColumnFamilyDropped.
+func (b *Batch) MergeCF(cf *ColumnFamily, key, operand []byte) {
+	if b.useCF(cf) {
+		b.Merge(key, operand)
+		b.entries[len(b.entries)-1].CF = cf.id
+	}
+}
+
+// DeleteCF adds a DELETE in column family cf to the batch.
+// A nil cf makes Engine.Write fail with ErrColumnFamilyDropped.
+func (b *Batch) DeleteCF(cf *ColumnFamily, key []byte) {
+	if b.useCF(cf) {
+		b.Delete(key)
+		b.entries[len(b.entries)-1].CF = cf.id
+	}
+}
+
+// records cf for Engine.Write to check, reporting whether it is usable.
+func (b *Batch) useCF(cf *ColumnFamily) bool {
+	if cf == nil {
+		if b.err == nil {
+			b.err = ErrColumnFamilyDropped
+		}
+		return false
+	}
+	if !slices.Contains(b.cfs, cf) {
+		b.cfs = append(b.cfs, cf)
+	}
+	return true
+}
+
+// Len returns the number of writes in the batch.
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
+
+// Reset empties the batch for reuse.
+func (b *Batch) Reset() {
+	b.entries = b.entries[:0]
+	b.cfs = b.cfs[:0]
+	b.err = nil
+}
+
+// Write applies all writes of b atomically through a single WAL record,
+// even when they span several column families.
+// Writes receive consecutive sequence numbers in batch order. Nothing is
+// written if a column family of b is nil, dropped or of another Engine.
+func (e *Engine) Write(b *Batch) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.writeBatchOf(b)
+}
+
+// logs and applies the writes of b once its column families are checked.
+// Caller must hold e.mu.
+func (e *Engine) writeBatchOf(b *Batch) error {
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if b.err != nil {
+		return b.err
+	}
+	for _, cf := range b.cfs {
+		if err := e.checkColumnFamily(cf); err != nil {
+			return err
+		}
+	}
+	return e.writeBatch(b.entries)
+}
+
+// logs and applies entries as one batch. Caller must hold e.mu.
+func (e *Engine) writeBatch(entries []wal.Entry) error {
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, op := range entries {
+		if err := e.checkBatchEntry(op); err != nil {
+			return err
+		}
+		cf, ok := e.cfs[op.CF]
+		if !ok {
+			return ErrColumnFamilyDropped
+		}
+		if op.Merge && cf.opts.MergeOperator == nil {
+			return ErrNoMergeOperator
+		}
+	}
+
+	if err := e.wal.AppendBatch(e.seq+1, entries); err != nil {
+		return err
+	}
+
+	e.applyBatch(entries)
+	return nil
+}
+
+// validates one batch entry. Caller must hold e.mu.
+func (e *Engine) checkBatchEntry(op wal.Entry) error {
+	if op.RangeDelete {
+		return e.checkRange(op.Key, op.Value)
+	}
+	return e.checkEntry(op.Key, op.Value)
+}
+
+// applies logged entries to the active memtables of their column families
+// with sequences e.seq+1, e.seq+2, ..., then flushes the full ones.
+// Caller must hold e.mu.
+func (e *Engine) applyBatch(entries []wal.Entry) {
+	first := e.seq + 1
+	touched := make(map[uint32]*ColumnFamily)
+	for i, op := range entries {
+		cf, ok := e.cfs[op.CF]
+		if !ok {
+			continue // dropped while a prepared transaction waited
+		}
+		applyEntry(cf, op, first+uint64(i))
+		e.recordWrite(op.Key, op.Value)
+		touched[op.CF] = cf
+	}
+	e.seq += uint64(len(entries))
+
+	for _, cf := range touched {
+		e.maybeFlush(cf)
+	}
+}
@@ -0,0 +1,515 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/memtable"
+	"vern_kv/ratelimit"
+	"vern_kv/sstable"
+	"vern_kv/stats"
+	"vern_kv/wal"
+)
+
+const defaultColumnFamily = "default"
+
+// ColumnFamily is a named keyspace with its own memtables, SSTables and
+// options. All column families of an Engine share its WAL and sequence
+// counter, so a Batch spanning several of them is still atomic.
+type ColumnFamily struct {
+	id   uint32
+	name string
+	opts config.ColumnFamilyOptions
+	dir  string
+	now  func() time.Time
+	cmp  config.Comparator
+
+	// report SingleDelete misuse (Config.Debug)
+	debug bool
+
+	// Config.MaxKeySize. Values are not limited in tables, as merges may
+	// fold operands into values larger than Config.MaxValueSize.
+	maxKey int
+
+	// the engine statistics and event queue (nil when disabled)
+	stats  *stats.Stats
+	events *eventQueue
+	log    *slog.Logger
+
+	// Config.RateLimiter, throttling table writes
+	limiter *ratelimit.RateLimiter
+
+	active   *memtable.Memtable
+	frozen   []*memtable.Memtable // oldest first
+	sstables []*tableInfo
+
+	// a table is being written without e.mu by a flush (of frozen[0]) or
+	// a compaction; see Engine.waitBackground
+	flushing   bool
+	compacting bool
+
+	// unix nanoseconds naming the last table written
+	lastTable atomic.Int64
+
+	// last condition reported under Config.WriteStall
+	stall config.WriteStallCondition
+
+	// background work relieving the stall is scheduled or running; see
+	// Engine.relieveStall
+	relieving bool
+
+	dropped bool
+}
+
+// Name returns the column family name.
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+// ID returns the column family id (0 for the default one).
+func (cf *ColumnFamily) ID() uint32 {
+	return cf.id
+}
+
+// registers a column family. Caller must hold e.mu (or be in Open).
+func (e *Engine) newColumnFamily(id uint32, name string, opts config.ColumnFamilyOptions, dir string) *ColumnFamily {
+	cf := &ColumnFamily{
+		id:   id,
+		name: name,
+		opts: opts,
+		dir:  dir,
+		now:  e.cfg.Now,
+		cmp:  e.cfg.KeyComparator(),
+
+		debug: e.cfg.Debug,
+
+		maxKey: e.cfg.KeySizeLimit(),
+
+		stats:  e.stats,
+		events: e.events,
+		log:    e.log,
+
+		limiter: e.cfg.RateLimiter,
+	}
+	cf.active = cf.newMemtable()
+
+	e.cfs[id] = cf
+	return cf
+}
+
+// creates a memtable configured from the column family options.
+func (cf *ColumnFamily) newMemtable() *memtable.Memtable {
+	return memtable.NewWithOptions(memtable.Options{
+		PrefixExtractor: cf.opts.PrefixExtractor,
+		MergeOperator:   cf.opts.MergeOperator,
+		Clock:           cf.now,
+		Comparator:      cf.cmp,
+	})
+}
+
+// opens one of the column family's SSTables (or returns its pinned handle).
+func (cf *ColumnFamily) openTable(t *tableInfo) (*sstable.SSTable, error) {
+	if t.pinned != nil {
+		return t.pinned, nil
+	}
+	cf.stats.Add(stats.SSTableOpens, 1)
+	return sstable.OpenWithOptions(t.path, cf.readOptions())
+}
+
+// returns the options tables are opened with.
+func (cf *ColumnFamily) readOptions() sstable.ReadOptions {
+	return sstable.ReadOptions{
+		Comparator: cf.cmp,
+		MaxKeySize: cf.maxKey,
+	}
+}
+
+// releases a table returned by openTable.
+func (cf *ColumnFamily) closeTable(t *tableInfo, st *sstable.SSTable) {
+	if st != t.pinned {
+		st.Close()
+	}
+}
+
+// opens a table for a reader that runs without e.mu; a pinned handle
+// stays open until every such reader releases it. Caller must hold e.mu.
+func (cf *ColumnFamily) acquireTable(t *tableInfo) (*sstable.SSTable, error) {
+	if t.pinned != nil {
+		t.readers++
+		return t.pinned, nil
+	}
+	return cf.openTable(t)
+}
+
+// releases a table returned by acquireTable (pinned tells whether it was
+// the pinned handle). Caller must hold e.mu.
+func (cf *ColumnFamily) releaseTable(t *tableInfo, st *sstable.SSTable, pinned bool) {
+	if !pinned {
+		st.Close()
+		return
+	}
+	t.readers--
+	if t.readers == 0 && t.pinned == nil {
+		st.Close()
+	}
+}
+
+// groups versions gathered newest source first into per-key runs
+// (newest first), ordered by the comparator.
+func (cf *ColumnFamily) groupVersions(all []sstable.Entry) [][]sstable.Entry {
+	sort.SliceStable(all, func(i, j int) bool {
+		return cf.cmp.Compare(all[i].Key, all[j].Key) < 0
+	})
+
+	var groups [][]sstable.Entry
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && cf.cmp.Compare(all[i].Key, all[j].Key) == 0 {
+			j++
+		}
+		groups = append(groups, all[i:j])
+		i = j
+	}
+	return groups
+}
+
+// DefaultColumnFamily returns the handle used by Put, Get and Delete.
+func (e *Engine) DefaultColumnFamily() *ColumnFamily {
+	return e.def
+}
+
+// ColumnFamily returns the live column family called name.
+func (e *Engine) ColumnFamily(name string) (*ColumnFamily, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, cf := range e.cfs {
+		if cf.name == name {
+			return cf, true
+		}
+	}
+	return nil, false
+}
+
+// ColumnFamilies returns the names of all live column families, sorted.
+func (e *Engine) ColumnFamilies() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.cfs))
+	for _, cf := range e.cfs {
+		names = append(names, cf.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CreateColumnFamily durably creates a column family.
+// Zero option fields inherit Config.ColumnFamilies[name], then the engine
+// Config. MemtableSizeBytes and the merge operator name are recorded in the
+// WAL, so Open restores the former and refuses a missing or different
+// merge operator.
+func (e *Engine) CreateColumnFamily(name string, opts config.ColumnFamilyOptions) (*ColumnFamily, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return nil, err
+	}
+	for _, cf := range e.cfs {
+		if cf.name == name {
+			return nil, ErrColumnFamilyExists
+		}
+	}
+
+	id := e.nextCF
+	dir := e.cfg.ColumnFamilyDir(id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := e.wal.AppendCreateColumnFamily(id, name, recordedOptions(opts)); err != nil {
+		return nil, err
+	}
+	e.nextCF++
+
+	return e.newColumnFamily(id, name, e.cfg.ColumnFamilyOptionsFor(name, opts), dir), nil
+}
+
+// returns the options of opts recorded in the WAL.
+func recordedOptions(opts config.ColumnFamilyOptions) wal.ColumnFamilyOptions {
+	rec := wal.ColumnFamilyOptions{MemtableSizeBytes: opts.MemtableSizeBytes}
+	if opts.MergeOperator != nil {
+		rec.MergeOperator = opts.MergeOperator.Name()
+	}
+	return rec
+}
+
+// resolves the options of a recovered column family as CreateColumnFamily
+// did from the options it recorded.
+func recoveredOptions(cfg config.Config, name string, rec wal.ColumnFamilyOptions) (config.ColumnFamilyOptions, error) {
+	opts := cfg.ColumnFamilyOptionsFor(name, config.ColumnFamilyOptions{
+		MemtableSizeBytes: rec.MemtableSizeBytes,
+	})
+	if rec.MergeOperator != "" && (opts.MergeOperator == nil || opts.MergeOperator.Name() != rec.MergeOperator) {
+		return opts, fmt.Errorf("%w: column family %q was created with merge operator %q",
+			ErrNoMergeOperator, name, rec.MergeOperator)
+	}
+	return opts, nil
+}
+
+// DropColumnFamily durably drops a column family and deletes its SSTables.
+// The default column family cannot be dropped.
+func (e *Engine) DropColumnFamily(cf *ColumnFamily) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkColumnFamily(cf); err != nil {
+		return err
+	}
+	if cf.id == 0 {
+		return ErrDropDefaultColumnFamily
+	}
+
+	// its directory must not be removed under a table write
+	for cf.flushing || cf.compacting {
+		e.waitBackground()
+		if err := e.checkWritable(); err != nil {
+			return err
+		}
+		if err := e.checkColumnFamily(cf); err != nil {
+			return err
+		}
+	}
+
+	if err := e.wal.AppendDropColumnFamily(cf.id, cf.name); err != nil {
+		return err
+	}
+
+	cf.dropped = true
+	delete(e.cfs, cf.id)
+	e.stallRelief()
+	if err := os.RemoveAll(cf.dir); err != nil {
+		return err
+	}
+	for _, t := range cf.sstables {
+		cf.tableDeleted(t.path)
+	}
+	return nil
+}
+
+// reports the deletion of one of the column family's table files.
+func (cf *ColumnFamily) tableDeleted(path string) {
+	cf.log.Info("table deleted", "cf", cf.name, "path", path)
+	cf.events.tableFileDeleted(config.TableFileInfo{ColumnFamily: cf.name, Path: path})
+}
+
+// reports whether cf is a live column family of e. Caller must hold e.mu.
+func (e *Engine) checkColumnFamily(cf *ColumnFamily) error {
+	if cf == nil || cf.dropped || e.cfs[cf.id] != cf {
+		return ErrColumnFamilyDropped
+	}
+	return nil
+}
+
+// PutCF writes key in column family cf.
+func (e *Engine) PutCF(cf *ColumnFamily, key, value []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.writeCF(cf, wal.Entry{Key: key, Value: value})
+}
+
+// MergeCF records operand for key in column family cf, folded by the
+// merge operator of cf.
+func (e *Engine) MergeCF(cf *ColumnFamily, key, operand []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.writeCF(cf, wal.Entry{Key: key, Value: operand, Merge: true})
+}
+
+// DeleteCF deletes key in column family cf.
+func (e *Engine) DeleteCF(cf *ColumnFamily, key []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.writeCF(cf, wal.Entry{Key: key, Tombstone: true})
+}
+
+// logs and applies entry in column family cf. Caller must hold e.mu.
+func (e *Engine) writeCF(cf *ColumnFamily, entry wal.Entry) error {
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkColumnFamily(cf); err != nil {
+		return err
+	}
+	entry.CF = cf.id
+	return e.writeBatch([]wal.Entry{entry})
+}
+
+// GetCF returns the latest value of key in column family cf.
+func (e *Engine) GetCF(cf *ColumnFamily, key []byte) ([]byte, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkOpen(); err != nil {
+		return nil, false, err
+	}
+	if err := e.checkColumnFamily(cf); err != nil {
+		return nil, false, err
+	}
+	return cf.get(key)
+}
+
+// ScanPrefixCF is ScanPrefix on column family cf.
+func (e *Engine) ScanPrefixCF(cf *ColumnFamily, prefix []byte, fn func(key, value []byte) bool) error {
+	return e.scanPrefix(context.Background(), cf, prefix, fn)
+}
+
+// returns the file name of a new table, named after the current time but
+// always after the tables written before, even concurrently.
+func (cf *ColumnFamily) nextTableName() string {
+	for {
+		last := cf.lastTable.Load()
+		n := max(time.Now().UnixNano(), last+1)
+		if cf.lastTable.CompareAndSwap(last, n) {
+			return fmt.Sprintf("sst_%d.sst", n)
+		}
+	}
+}
+
+// writes entries and range tombstones to a new SSTable (via a temp file and
+// rename) recording the sequence range [minSeq, maxSeq].
+func (cf *ColumnFamily) writeTable(entries []sstable.Entry, dels []sstable.RangeTombstone, minSeq, maxSeq uint64) (*tableInfo, error) {
+	filename := cf.nextTableName()
+	tmpPath := filepath.Join(cf.dir, filename+".tmp")
+	finalPath := filepath.Join(cf.dir, filename)
+
+	opts := sstable.WriteOptions{
+		PrefixExtractor: cf.opts.PrefixExtractor,
+		Comparator:      cf.cmp,
+		RangeTombstones: dels,
+		RateLimiter:     cf.limiter,
+		MinSeq:          minSeq,
+		MaxSeq:          maxSeq,
+	}
+	if err := sstable.WriteWithOptions(tmpPath, entries, opts); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(finalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &tableInfo{
+		path:    finalPath,
+		dels:    dels,
+		size:    stat.Size(),
+		entries: len(entries),
+		minSeq:  minSeq,
+		maxSeq:  maxSeq,
+	}
+	cf.events.tableFileCreated(config.TableFileInfo{ColumnFamily: cf.name, Path: finalPath, Size: info.size})
+	if cf.opts.PrefixExtractor != nil {
+		info.filter = sstable.BuildPrefixFilter(entries, cf.opts.PrefixExtractor)
+	}
+
+	return info, nil
+}
+
+// returns the live value of key.
+func (cf *ColumnFamily) get(key []byte) ([]byte, bool, error) {
+	entry, ok, err := cf.getEntry(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !ok || entry.Tombstone {
+		return nil, false, nil
+	}
+
+	return entry.Value, true, nil
+}
+
+// returns the newest version of a key, tombstones included.
+// Merge operands are folded onto the first older value found.
+func (cf *ColumnFamily) getEntry(key []byte) (sstable.Entry, bool, error) {
+	cf.stats.Add(stats.KeysRead, 1)
+
+	var versions []sstable.Entry
+
+	// 1. Memtables (newest first)
+	for _, mt := range cf.memtables() {
+		if entry, ok := mt.Get(key); ok {
+			versions = append(versions, memtableToSSTable(entry))
+			if !entry.Merge {
+				return cf.resolve(versions)
+			}
+		}
+	}
+
+	// 2. SSTables (newest → oldest)
+	for i := len(cf.sstables) - 1; i >= 0; i-- {
+		if !cf.tableMayContainKey(cf.sstables[i], key) {
+			continue
+		}
+
+		st, err := cf.openTable(cf.sstables[i])
+		if err != nil {
+			return sstable.Entry{}, false, err
+		}
+
+		cf.stats.Add(stats.SSTableProbes, 1)
+		entry, ok, err := st.Get(key)
+		cf.closeTable(cf.sstables[i], st)
+		if err != nil {
+			return sstable.Entry{}, false, err
+		}
+
+		// Older SSTables cannot override a non-merge entry.
+		if ok {
+			versions = append(versions, entry)
+			if !entry.Merge {
+				break
+			}
+		}
+	}
+
+	return cf.resolve(versions)
+}
+
+// reports whether a table can hold key according to its prefix filter.
+func (cf *ColumnFamily) tableMayContainKey(t *tableInfo, key []byte) bool {
+	if cf.opts.PrefixExtractor == nil {
+		return true
+	}
+	return t.filter.MayContain(cf.opts.PrefixExtractor(key))
+}
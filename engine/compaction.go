@@ -0,0 +1,148 @@
+package engine
+
+import (
+	"os"
+	"slices"
+	"time"
+
+	"vern_kv/sstable"
+	"vern_kv/stats"
+)
+
+// Compact rewrites the SSTables of every column family into a single table
+// per column family.
+//
+// The output is the bottom of the tree, so every key is resolved to its
+// newest version: merge operands are fully merged and tombstones dropped.
+// Range tombstones are dropped along with the data they cover, and a
+// SingleDelete vanishes together with the value it deletes.
+// Memtables are not touched; their entries are newer than any table.
+// Reads, writes and flushes go on while the tables are rewritten.
+func (e *Engine) Compact() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+
+	for _, cf := range e.liveColumnFamilies() {
+		if err := e.compact(cf); err != nil {
+			e.log.Error("compaction failed", "cf", cf.name, "err", err)
+			return err
+		}
+	}
+	e.stats.Add(stats.Compactions, 1)
+	return nil
+}
+
+// compacts the current tables of cf into one. Caller must hold e.mu, which
+// is released while the tables are rewritten; the compactions of a column
+// family run one at a time.
+func (e *Engine) compact(cf *ColumnFamily) error {
+	for cf.compacting {
+		e.waitBackground()
+	}
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if cf.dropped || len(cf.sstables) == 0 {
+		return nil
+	}
+
+	old := slices.Clone(cf.sstables)
+	cf.compacting = true
+	e.mu.Unlock()
+
+	info, err := cf.compactTables(old)
+
+	e.mu.Lock()
+	cf.compacting = false
+	e.wakeBackground()
+	if err != nil {
+		return err
+	}
+
+	// tables flushed meanwhile follow the inputs
+	var tables []*tableInfo
+	if info != nil {
+		tables = append(tables, info)
+	}
+	cf.sstables = append(tables, cf.sstables[len(old):]...)
+
+	// oldest first, so that an interrupted deletion leaves inputs that
+	// Open recognizes as contained in the output
+	for _, t := range old {
+		if err := os.Remove(t.path); err != nil {
+			return err
+		}
+		cf.tableDeleted(t.path)
+	}
+	e.stallRelief()
+	return nil
+}
+
+// rewrites tables (oldest first) into one, returning nil when nothing is
+// left. Reads only immutable state, so it runs without e.mu.
+func (cf *ColumnFamily) compactTables(tables []*tableInfo) (*tableInfo, error) {
+	start := time.Now()
+
+	// all versions, newest table first, and the range tombstones
+	var versions []sstable.Entry
+	var dels []sstable.RangeTombstone
+	for i := len(tables) - 1; i >= 0; i-- {
+		st, err := cf.openTable(tables[i])
+		if err != nil {
+			return nil, err
+		}
+
+		all, err := st.ScanPrefix(nil)
+		st.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, all...)
+		dels = append(dels, tables[i].dels...)
+	}
+
+	var out []sstable.Entry
+	for _, vs := range cf.groupVersions(versions) {
+		if cf.debug {
+			if err := checkSingleDelete(vs); err != nil {
+				return nil, err
+			}
+		}
+
+		entry, ok, err := cf.resolveWith(vs, dels)
+		if err != nil {
+			return nil, err
+		}
+		if ok && !entry.Tombstone {
+			out = append(out, entry)
+		}
+	}
+
+	// The output records the sequence range of its inputs, so that Open
+	// recognizes inputs left behind by a crash as contained in it.
+	var info *tableInfo
+	if len(out) > 0 {
+		minSeq, maxSeq := tables[0].minSeq, tables[0].maxSeq
+		for _, t := range tables[1:] {
+			minSeq, maxSeq = min(minSeq, t.minSeq), max(maxSeq, t.maxSeq)
+		}
+
+		var err error
+		info, err = cf.writeTable(out, nil, minSeq, maxSeq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cf.log.Info("compaction",
+		"cf", cf.name,
+		"tables", len(tables),
+		"entries", len(out),
+		"duration", time.Since(start))
+	return info, nil
+}
@@ -0,0 +1,101 @@
+package engine
+
+import "bytes"
+
+// CondResult reports the outcome of a conditional write.
+type CondResult struct {
+	// Applied is true if the write was performed.
+	Applied bool
+
+	// Value and Found describe the key after the call: the new value if
+	// the write was applied, otherwise the value that failed the condition.
+	Value []byte
+	Found bool
+}
+
+// PutIfAbsent writes value only if key does not exist.
+func (e *Engine) PutIfAbsent(key, value []byte) (CondResult, error) {
+	if err := e.throttle(); err != nil {
+		return CondResult{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cur, found, err := e.currentValue(key)
+	if err != nil {
+		return CondResult{}, err
+	}
+	if found {
+		return CondResult{Value: cur, Found: true}, nil
+	}
+
+	if err := e.put(key, value); err != nil {
+		return CondResult{}, err
+	}
+	return CondResult{Applied: true, Value: value, Found: true}, nil
+}
+
+// CompareAndSwap writes newValue only if the current value equals expected.
+// A nil expected matches a missing key.
+func (e *Engine) CompareAndSwap(key, expected, newValue []byte) (CondResult, error) {
+	if err := e.throttle(); err != nil {
+		return CondResult{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cur, found, err := e.currentValue(key)
+	if err != nil {
+		return CondResult{}, err
+	}
+	if !matches(cur, found, expected) {
+		return CondResult{Value: cur, Found: found}, nil
+	}
+
+	if err := e.put(key, newValue); err != nil {
+		return CondResult{}, err
+	}
+	return CondResult{Applied: true, Value: newValue, Found: true}, nil
+}
+
+// DeleteIfEquals deletes key only if its current value equals expected.
+func (e *Engine) DeleteIfEquals(key, expected []byte) (CondResult, error) {
+	if err := e.throttle(); err != nil {
+		return CondResult{}, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cur, found, err := e.currentValue(key)
+	if err != nil {
+		return CondResult{}, err
+	}
+	if !found || !bytes.Equal(cur, expected) {
+		return CondResult{Value: cur, Found: found}, nil
+	}
+
+	if err := e.delete(key); err != nil {
+		return CondResult{}, err
+	}
+	return CondResult{Applied: true}, nil
+}
+
+// returns the live value of key. Caller must hold e.mu.
+func (e *Engine) currentValue(key []byte) ([]byte, bool, error) {
+	entry, ok, err := e.getEntry(key)
+	if err != nil || !ok || entry.Tombstone {
+		return nil, false, err
+	}
+	return entry.Value, true, nil
+}
+
+// reports whether the current state satisfies expected (nil = absent).
+func matches(cur []byte, found bool, expected []byte) bool {
+	if expected == nil {
+		return !found
+	}
+	return found && bytes.Equal(cur, expected)
+}
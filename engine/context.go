@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+
+	"vern_kv/stats"
+)
+
+// The Ctx variants give up with ctx.Err() while they wait for the engine,
+// e.g. behind a synchronous flush of another writer or a write stall. A
+// write gives up only before it is logged: once in the WAL it completes and
+// stays durable even if ctx expires meanwhile.
+
+// acquires e.mu unless ctx ends first. A lock acquired after the caller
+// gave up is released right away.
+func (e *Engine) lockCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.mu.TryLock() {
+		return nil
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		e.mu.Lock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		// ctx may have ended while we waited for the lock
+		if err := ctx.Err(); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			e.mu.Unlock()
+		}()
+		return ctx.Err()
+	}
+}
+
+// PutCtx is Put giving up with ctx.Err() before the write is logged.
+func (e *Engine) PutCtx(ctx context.Context, key, value []byte) error {
+	defer e.timeOp(stats.PutLatency)()
+
+	if err := e.stallWait(ctx, WriteOptions{}); err != nil {
+		return err
+	}
+	if err := e.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+
+	return e.put(key, value)
+}
+
+// DeleteCtx is Delete giving up with ctx.Err() before the write is logged.
+func (e *Engine) DeleteCtx(ctx context.Context, key []byte) error {
+	if err := e.stallWait(ctx, WriteOptions{}); err != nil {
+		return err
+	}
+	if err := e.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+
+	return e.delete(key)
+}
+
+// WriteCtx is Write giving up with ctx.Err() before the batch is logged;
+// a batch is applied entirely or not at all.
+func (e *Engine) WriteCtx(ctx context.Context, b *Batch) error {
+	if err := e.stallWait(ctx, WriteOptions{}); err != nil {
+		return err
+	}
+	if err := e.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer e.mu.Unlock()
+
+	return e.writeBatchOf(b)
+}
+
+// GetCtx is Get giving up with ctx.Err() while it waits for the engine.
+func (e *Engine) GetCtx(ctx context.Context, key []byte) ([]byte, bool, error) {
+	defer e.timeOp(stats.GetLatency)()
+
+	if err := e.lockCtx(ctx); err != nil {
+		return nil, false, err
+	}
+	defer e.mu.Unlock()
+
+	if err := e.checkOpen(); err != nil {
+		return nil, false, err
+	}
+	return e.def.get(key)
+}
+
+// ScanPrefixCtx is ScanPrefix giving up with ctx.Err() while it takes its
+// snapshot, or between two calls of fn.
+func (e *Engine) ScanPrefixCtx(ctx context.Context, prefix []byte, fn func(key, value []byte) bool) error {
+	return e.scanPrefix(ctx, e.def, prefix, fn)
+}
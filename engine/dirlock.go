@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const lockFileName = "LOCK"
+
+// LockedError reports the owner of a held database LOCK file.
+// It matches ErrLocked with errors.Is.
+type LockedError struct {
+	Path string
+	PID  int // 0 if the owner has not recorded it yet
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v: %s held by pid %d", ErrLocked, e.Path, e.PID)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// dirLock is an advisory lock on the LOCK file of a data directory,
+// recording the owner's PID.
+type dirLock struct {
+	file *os.File
+}
+
+// acquires the LOCK file of dir without blocking.
+func lockDir(dir string) (*dirLock, error) {
+	path := filepath.Join(dir, lockFileName)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	held, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if held {
+		pid := readLockPID(f)
+		f.Close()
+		return nil, &LockedError{Path: path, PID: pid}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &dirLock{file: f}, nil
+}
+
+// returns the PID recorded in a LOCK file (0 if unreadable).
+func readLockPID(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	return pid
+}
+
+// releases the lock. The LOCK file itself is left in place.
+func (l *dirLock) release() error {
+	unlockFile(l.file)
+	return l.file.Close()
+}
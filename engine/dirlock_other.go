@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package engine
+
+import "os"
+
+// advisory locking is not supported on this platform, so Open fails
+// rather than report a lock it does not hold.
+func tryLockFile(f *os.File) (held bool, err error) {
+	return false, ErrLockUnsupported
+}
+
+func unlockFile(f *os.File) {}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// the locked byte lies past any PID, so that the owner stays readable
+var lockRange = syscall.Overlapped{OffsetHigh: 1}
+
+// takes an exclusive LockFileEx on f, reporting whether another holder
+// has it.
+func tryLockFile(f *os.File) (held bool, err error) {
+	ol := lockRange
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately,
+		0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r != 0 {
+		return false, nil
+	}
+	if errors.Is(err, errorLockViolation) {
+		return true, nil
+	}
+	return false, err
+}
+
+func unlockFile(f *os.File) {
+	ol := lockRange
+	_, _, _ = procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+}
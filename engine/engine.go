@@ -2,14 +2,17 @@ package engine
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
 	"vern_kv/config"
+	"vern_kv/errs"
 	"vern_kv/memtable"
 	"vern_kv/sstable"
+	"vern_kv/stats"
 	"vern_kv/wal"
 )
 
@@ -19,121 +22,393 @@ type Engine struct {
 
 	wal *wal.WAL
 
-	active   *memtable.Memtable
-	frozen   *memtable.Memtable
-	sstables []string
+	// column families share the WAL and the sequence counter;
+	// def is the default one (id 0) used by the non-CF methods
+	def    *ColumnFamily
+	cfs    map[uint32]*ColumnFamily
+	nextCF uint32
 
 	mu  sync.Mutex
 	seq uint64
+
+	locks    *lockManager
+	prepared map[string][]wal.Entry
+
+	// opened by OpenReadOnly
+	readOnly bool
+
+	// exclusive LOCK file (nil when read-only)
+	lock *dirLock
+
+	closed bool
+
+	// nil unless Config.Statistics is set
+	stats *stats.Stats
+
+	// nil unless Config.EventListener is set
+	events *eventQueue
+
+	// closed and replaced to wake writers stopped by Config.WriteStall
+	stallWake    chan struct{}
+	stallStopped bool
+
+	// the engine log, and the LOG file behind it (nil for Config.Logger)
+	log     *slog.Logger
+	logFile io.Closer
+
+	// closed and replaced when a table write running without e.mu ends
+	bgWake chan struct{}
+
+	// flushes started by Flush(false); Close waits for them
+	bg sync.WaitGroup
+	// background flushes that failed
+	bgErrors int
 }
 
+// tableInfo is the in-memory handle of a flushed SSTable.
+// The prefix filter lets reads skip a table without opening it.
+type tableInfo struct {
+	path   string
+	filter *sstable.PrefixFilter
+	dels   []sstable.RangeTombstone
+
+	// summary reported by GetProperty
+	size           int64
+	entries        int
+	minSeq, maxSeq uint64
+
+	// kept open by a read-only engine, so the table stays readable after
+	// the writer compacts it away
+	pinned *sstable.SSTable
+	// prefix scans reading pinned without e.mu
+	readers int
+}
+
+// Open opens (or creates) the database in cfg.DataDir for reading and
+// writing. The LOCK file in DataDir is held until Close; another Open of
+// the same directory fails with ErrLocked. Where the file cannot be locked,
+// Open fails with ErrLockUnsupported.
 func Open(cfg config.Config) (*Engine, error) {
 	_ = os.MkdirAll(cfg.DataDir, 0755)
+
+	lock, err := lockDir(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	log, logFile, err := openLogger(cfg)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+
+	e, err := open(cfg, log)
+	if err != nil {
+		log.Error("open failed", "dir", cfg.DataDir, "err", err)
+		if logFile != nil {
+			logFile.Close()
+		}
+		lock.release()
+		return nil, err
+	}
+
+	e.lock = lock
+	e.logFile = logFile
+	return e, nil
+}
+
+func open(cfg config.Config, log *slog.Logger) (*Engine, error) {
+	start := time.Now()
+
 	_ = os.MkdirAll(cfg.WALDir(), 0755)
 	_ = os.MkdirAll(cfg.SSTableDir(), 0755)
 
-	w, err := wal.Open(cfg.WALDir())
+	st := newStats(cfg)
+	w, err := wal.OpenWithOptions(cfg.WALDir(), walOptions(cfg, false, st))
 	if err != nil {
 		return nil, err
 	}
 
-	active := memtable.New()
-	var maxSeq uint64
-
-	entries, err := w.Replay(0)
+	rec, err := w.Recover(0)
 	if err != nil {
+		w.Close()
 		return nil, err
 	}
 
-	for _, e := range entries {
-		if e.Seq <= maxSeq {
+	if err := checkComparator(w, rec, cfg.KeyComparator()); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	e := &Engine{
+		cfg:    cfg,
+		wal:    w,
+		stats:  st,
+		events: newEventQueue(cfg.EventListener),
+		log:    log,
+		cfs:    make(map[uint32]*ColumnFamily),
+
+		stallWake: make(chan struct{}),
+		bgWake:    make(chan struct{}),
+		nextCF:    rec.MaxColumnFamilyID + 1,
+		locks:     newLockManager(),
+		prepared:  make(map[string][]wal.Entry),
+	}
+
+	e.def = e.newColumnFamily(0, defaultColumnFamily, cfg.DefaultColumnFamilyOptions(), cfg.SSTableDir())
+	for id, name := range rec.ColumnFamilies {
+		opts, err := recoveredOptions(cfg, name, rec.ColumnFamilyOptions[id])
+		if err != nil {
+			e.events.close()
+			w.Close()
+			return nil, err
+		}
+		e.newColumnFamily(id, name, opts, cfg.ColumnFamilyDir(id))
+	}
+
+	// tables, and the sequence each column family has flushed up to
+	flushed := make(map[uint32]uint64)
+	var tables int
+	for id, cf := range e.cfs {
+		if err := cf.loadTables(); err != nil {
+			e.events.close()
+			w.Close()
+			return nil, err
+		}
+		for _, t := range cf.sstables {
+			flushed[id] = max(flushed[id], t.maxSeq)
+		}
+		tables += len(cf.sstables)
+	}
+
+	// A flush writes every older entry of its column family, so only
+	// records above that column family's newest table need replaying.
+	var maxSeq uint64
+	var replayed int
+	for _, entry := range rec.Entries {
+		if entry.Seq <= maxSeq {
 			continue
 		}
-		if e.Tombstone {
-			active.Delete(e.Key, e.Seq)
-		} else {
-			active.Put(e.Key, e.Value, e.Seq)
+		maxSeq = entry.Seq
+
+		cf, ok := e.cfs[entry.CF]
+		if !ok || entry.Seq <= flushed[entry.CF] {
+			continue // dropped column family, or flushed
 		}
-		maxSeq = e.Seq
+		if entry.Merge && cf.opts.MergeOperator == nil {
+			e.events.close()
+			w.Close()
+			return nil, ErrNoMergeOperator
+		}
+		applyEntry(cf, entry, entry.Seq)
+		replayed++
+	}
+	for _, s := range flushed {
+		maxSeq = max(maxSeq, s)
 	}
+	e.seq = maxSeq
 
-	return &Engine{
-		cfg:    cfg,
-		wal:    w,
-		active: active,
-		frozen: nil,
-		seq:    maxSeq,
-	}, nil
+	for _, p := range rec.Prepared {
+		e.prepared[p.Name] = p.Entries
+	}
+
+	log.Info("recovered",
+		"dir", cfg.DataDir,
+		"records", replayed,
+		"max_seq", maxSeq,
+		"tables", tables,
+		"column_families", len(e.cfs),
+		"prepared", len(rec.Prepared),
+		"duration", time.Since(start))
+	return e, nil
+}
+
+// returns the statistics enabled by cfg, or nil.
+func newStats(cfg config.Config) *stats.Stats {
+	if !cfg.Statistics {
+		return nil
+	}
+	return stats.New()
+}
+
+// returns the WAL options derived from cfg.
+func walOptions(cfg config.Config, readOnly bool, st *stats.Stats) wal.Options {
+	return wal.Options{
+		ReadOnly:     readOnly,
+		Stats:        st,
+		RateLimiter:  cfg.RateLimiter,
+		MaxKeySize:   cfg.KeySizeLimit(),
+		MaxValueSize: cfg.ValueSizeLimit(),
+	}
+}
+
+// refuses a comparator other than the one the database was created with,
+// and records the comparator of a new database.
+// A WAL without a comparator record predates it and is bytewise.
+func checkComparator(w *wal.WAL, rec *wal.Recovery, cmp config.Comparator) error {
+	stored := rec.Comparator
+	if stored == "" {
+		size, err := w.Size()
+		if err != nil {
+			return err
+		}
+		if size > 0 {
+			stored = config.BytewiseComparator.Name()
+		}
+	}
+
+	if stored != "" && stored != cmp.Name() {
+		return fmt.Errorf("%w: database uses %q, config has %q", ErrComparatorMismatch, stored, cmp.Name())
+	}
+
+	if rec.Comparator == "" {
+		return w.AppendComparator(cmp.Name())
+	}
+	return nil
+}
+
+// inserts a logged write into the active memtable of cf at seq.
+func applyEntry(cf *ColumnFamily, e wal.Entry, seq uint64) {
+	mt := cf.active
+	switch {
+	case e.RangeDelete:
+		mt.DeleteRange(e.Key, e.Value, seq)
+	case e.SingleDelete:
+		mt.SingleDeleteOlder(e.Key, seq, cf.mayHaveOlder(e.Key))
+	case e.Tombstone:
+		mt.Delete(e.Key, seq)
+	case e.Merge:
+		mt.Merge(e.Key, e.Value, seq)
+	case e.ExpiresAt != 0:
+		mt.PutWithExpiry(e.Key, e.Value, seq, e.ExpiresAt)
+	default:
+		mt.Put(e.Key, e.Value, seq)
+	}
 }
 
 func (e *Engine) Put(key, value []byte) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	defer e.timeOp(stats.PutLatency)()
 
-	e.seq++
-	if err := e.wal.AppendPut(e.seq, key, value); err != nil {
-		e.seq--
+	if err := e.throttle(); err != nil {
 		return err
 	}
 
-	e.active.Put(key, value, e.seq)
-	e.maybeFlush()
-	return nil
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.put(key, value)
 }
 
 func (e *Engine) Delete(key []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	e.seq++
-	if err := e.wal.AppendDelete(e.seq, key); err != nil {
-		e.seq--
-		return err
+	return e.delete(key)
+}
+
+// returns ErrClosed once the engine is closed. Caller must hold e.mu.
+func (e *Engine) checkOpen() error {
+	if e.closed {
+		return ErrClosed
 	}
+	return nil
+}
 
-	e.active.Delete(key, e.seq)
-	e.maybeFlush()
+// returns the error refusing writes, if any. Caller must hold e.mu.
+func (e *Engine) checkWritable() error {
+	if e.closed {
+		return ErrClosed
+	}
+	if e.readOnly {
+		return ErrReadOnly
+	}
 	return nil
 }
 
-func (e *Engine) maybeFlush() {
-	if e.active.ApproximateSize() < e.cfg.MemtableSizeBytes {
-		return
+// validates a key and value against the configured limits before they
+// are logged.
+func (e *Engine) checkEntry(key, value []byte) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	return errs.CheckSize(key, value, e.cfg.KeySizeLimit(), e.cfg.ValueSizeLimit())
+}
+
+// logs and applies a PUT. Caller must hold e.mu.
+func (e *Engine) put(key, value []byte) error {
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkEntry(key, value); err != nil {
+		return err
 	}
 
-	// Freeze
-	e.frozen = e.active
-	e.active = memtable.New()
+	e.seq++
+	if err := e.wal.AppendPut(e.seq, key, value); err != nil {
+		e.seq--
+		return err
+	}
 
-	// Flush synchronously
-	e.flushFrozen()
+	e.def.active.Put(key, value, e.seq)
+	e.recordWrite(key, value)
+	e.maybeFlush(e.def)
+	return nil
 }
 
-func (e *Engine) flushFrozen() {
-	if e.frozen == nil {
-		return
+// logs and applies a DELETE. Caller must hold e.mu.
+func (e *Engine) delete(key []byte) error {
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkEntry(key, nil); err != nil {
+		return err
 	}
 
-	entries := e.frozen.AllEntriesSorted()
-	if len(entries) == 0 {
-		e.frozen = nil
-		return
+	e.seq++
+	if err := e.wal.AppendDelete(e.seq, key); err != nil {
+		e.seq--
+		return err
 	}
 
-	filename := fmt.Sprintf("sst_%d.sst", time.Now().UnixNano())
-	tmpPath := filepath.Join(e.cfg.SSTableDir(), filename+".tmp")
-	finalPath := filepath.Join(e.cfg.SSTableDir(), filename)
+	e.def.active.Delete(key, e.seq)
+	e.recordWrite(key, nil)
+	e.maybeFlush(e.def)
+	return nil
+}
 
-	if err := sstable.Write(tmpPath, entries); err != nil {
-		panic(err)
+// starts timing a foreground operation; the returned func records its
+// latency in h. Read latencies are also reported to an auto-tuned
+// Config.RateLimiter; write latencies are not, as a write may wait for a
+// flush throttled by that very limiter.
+func (e *Engine) timeOp(h stats.Histogram) func() {
+	if e.stats == nil && e.cfg.RateLimiter == nil {
+		return func() {}
 	}
 
-	if err := os.Rename(tmpPath, finalPath); err != nil {
-		panic(err)
+	start := time.Now()
+	return func() {
+		d := time.Since(start)
+		e.stats.Observe(h, d)
+		if h == stats.GetLatency {
+			e.cfg.RateLimiter.ReportLatency(d)
+		}
 	}
+}
 
-	e.sstables = append(e.sstables, finalPath)
-	e.frozen = nil
+// counts one logged write.
+func (e *Engine) recordWrite(key, value []byte) {
+	e.stats.Add(stats.KeysWritten, 1)
+	e.stats.Add(stats.BytesWritten, uint64(len(key)+len(value)))
+}
+
+// Stats returns the engine statistics, or nil unless Config.Statistics is
+// set. A nil *stats.Stats reads as zero and serves an empty exposition.
+func (e *Engine) Stats() *stats.Stats {
+	return e.stats
 }
 
 // Intended for testing and diagnostics only.
@@ -146,77 +421,126 @@ func (e *Engine) Sequence() uint64 {
 // Memtable returns the latest entry for a key.
 // Intended for testing and diagnostics only.
 func (e *Engine) MemtableGet(key []byte) (memtable.Entry, bool) {
-	return e.active.Get(key)
+	return e.def.active.Get(key)
 }
 
 // Get returns the latest value for a key.
 // If the key is deleted or not found, found = false(not found) is returned.
 func (e *Engine) Get(key []byte) ([]byte, bool, error) {
+	defer e.timeOp(stats.GetLatency)()
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	var (
-		bestSeq uint64
-		found   bool
-		value   []byte
-	)
-
-	// 1. Active Memtable
-	if e.active != nil {
-		if entry, ok := e.active.Get(key); ok {
-			if entry.Seq > bestSeq {
-				bestSeq = entry.Seq
-				found = !entry.Tombstone
-				value = entry.Value
-			}
-		}
+	if err := e.checkOpen(); err != nil {
+		return nil, false, err
 	}
+	return e.def.get(key)
+}
 
-	// 2. Frozen Memtable
-	if e.frozen != nil {
-		if entry, ok := e.frozen.Get(key); ok {
-			if entry.Seq > bestSeq {
-				bestSeq = entry.Seq
-				found = !entry.Tombstone
-				value = entry.Value
-			}
-		}
+// Lookup is Get reporting a missing or deleted key as ErrNotFound.
+func (e *Engine) Lookup(key []byte) ([]byte, error) {
+	val, ok, err := e.Get(key)
+	if err != nil {
+		return nil, err
 	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return val, nil
+}
 
-	// 3. SSTables (newest → oldest)
-	for i := len(e.sstables) - 1; i >= 0; i-- {
-		st, err := sstable.Open(e.sstables[i])
-		if err != nil {
-			return nil, false, err
-		}
+// returns the newest version of a key in the default column family.
+// Caller must hold e.mu.
+func (e *Engine) getEntry(key []byte) (sstable.Entry, bool, error) {
+	if err := e.checkOpen(); err != nil {
+		return sstable.Entry{}, false, err
+	}
+	return e.def.getEntry(key)
+}
 
-		entry, ok, err := st.Get(key)
-		st.Close()
-		if err != nil {
-			return nil, false, err
-		}
+// converts a memtable entry to its persisted form.
+func memtableToSSTable(me memtable.Entry) sstable.Entry {
+	return sstable.Entry{
+		Key:       me.Key,
+		Value:     me.Value,
+		Seq:       me.Seq,
+		Tombstone: me.Tombstone,
+		Merge:     me.Merge,
+		Operands:  me.Operands,
+		ExpiresAt: me.ExpiresAt,
+
+		SingleDelete: me.SingleDelete,
+	}
+}
 
-		if ok && entry.Seq > bestSeq {
-			bestSeq = entry.Seq
-			found = !entry.Tombstone
-			value = entry.Value
-		}
+// ScanPrefix calls fn for every live key starting with prefix, in key order,
+// until fn returns false.
+// Tables whose prefix filter excludes prefix are skipped without being opened,
+// and the others are read as the scan advances, so stopping early saves the
+// rest of their reads.
+// fn runs without the engine lock held, over a snapshot taken at call time.
+func (e *Engine) ScanPrefix(prefix []byte, fn func(key, value []byte) bool) error {
+	return e.ScanPrefixCF(e.def, prefix, fn)
+}
 
-		// Optimization: if we already found a newer entry,
-		// older SSTables cannot override it.
-		if found || bestSeq > 0 {
-			break
+// Close - shuts down the engine.
+// It stops accepting operations, finishes the flushes in progress, flushes
+// the other memtables if Config.FlushOnClose is set, fsyncs and closes the
+// WAL and releases the LOCK file. Every other method of a closed engine
+// returns ErrClosed; closing again is a no-op. Close delivers the pending
+// events before it returns, so it must not be called from an EventListener
+// callback.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	e.wakeStalled()
+	e.mu.Unlock()
+
+	e.bg.Wait()
+
+	e.mu.Lock()
+	for e.writingTables() {
+		e.waitBackground()
+	}
+
+	var err error
+	if !e.readOnly {
+		err = e.flushOnClose(e.cfg.FlushOnClose)
+		if serr := e.wal.Sync(); err == nil {
+			err = serr
 		}
 	}
 
-	if !found {
-		return nil, false, nil
+	for _, cf := range e.cfs {
+		cf.unpinTables()
 	}
 
-	return value, true, nil
-}
+	if cerr := e.wal.Close(); err == nil {
+		err = cerr
+	}
+	if e.lock != nil {
+		if lerr := e.lock.release(); err == nil {
+			err = lerr
+		}
+		e.lock = nil
+	}
+	e.mu.Unlock()
 
-// Close - shuts down the engine.
-func (e *Engine) Close() error {
-	return e.wal.Close()
+	// deliver the events of the work above outside the lock
+	e.events.close()
+
+	if err != nil {
+		e.log.Error("close failed", "err", err)
+	} else {
+		e.log.Info("closed", "last_seq", e.seq)
+	}
+	if e.logFile != nil {
+		e.logFile.Close()
+	}
+	return err
 }
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"errors"
+
+	"vern_kv/errs"
+)
+
+var (
+	// ErrConflict is returned by OptimisticTxn.Commit when a key read by the
+	// transaction changed before the commit.
+	ErrConflict = errors.New("engine: transaction conflict")
+
+	// ErrTxnDone is returned when a committed or rolled back transaction is used.
+	ErrTxnDone = errors.New("engine: transaction already finished")
+
+	// ErrLockTimeout is returned when a key lock is not granted within
+	// Config.LockTimeout.
+	ErrLockTimeout = errors.New("engine: lock wait timed out")
+
+	// ErrDeadlock is returned when waiting for a key lock would close a
+	// cycle in the wait-for graph.
+	ErrDeadlock = errors.New("engine: deadlock detected")
+
+	// ErrTxnExists is returned by Prepare when the transaction name is
+	// already used by another prepared transaction.
+	ErrTxnExists = errors.New("engine: prepared transaction already exists")
+
+	// ErrUnknownTxn is returned when no prepared transaction has the name.
+	ErrUnknownTxn = errors.New("engine: unknown prepared transaction")
+
+	// ErrNotPrepared is returned by TwoPhaseTxn.Commit before Prepare.
+	ErrNotPrepared = errors.New("engine: transaction not prepared")
+
+	// ErrNoMergeOperator is returned by merge writes (and by Open when the
+	// WAL holds merge records) if the column family has no merge operator,
+	// and by Open when a column family lost the operator it was created with.
+	ErrNoMergeOperator = errors.New("engine: no merge operator configured")
+
+	// ErrInvalidTTL is returned by PutWithTTL for a non-positive TTL.
+	ErrInvalidTTL = errors.New("engine: ttl must be positive")
+
+	// ErrColumnFamilyExists is returned by CreateColumnFamily for a name in use.
+	ErrColumnFamilyExists = errors.New("engine: column family already exists")
+
+	// ErrColumnFamilyDropped is returned when using a dropped column family.
+	ErrColumnFamilyDropped = errors.New("engine: column family dropped")
+
+	// ErrDropDefaultColumnFamily is returned when dropping the default column family.
+	ErrDropDefaultColumnFamily = errors.New("engine: cannot drop the default column family")
+
+	// ErrComparatorMismatch is returned by Open when Config.Comparator has a
+	// different name than the comparator the database was created with.
+	ErrComparatorMismatch = errors.New("engine: comparator mismatch")
+
+	// ErrInvalidRange is returned by DeleteRange when start is not before end.
+	ErrInvalidRange = errors.New("engine: range start must be before end")
+
+	// ErrSingleDeleteMisuse reports, in debug mode, a SingleDelete of a key
+	// that was written more than once.
+	ErrSingleDeleteMisuse = errors.New("engine: single delete of a key written more than once")
+
+	// ErrReadOnly is returned by writes on an engine opened with OpenReadOnly.
+	ErrReadOnly = errors.New("engine: database opened read-only")
+
+	// ErrLocked is returned by Open when another engine holds the database
+	// LOCK file; the returned error is a *LockedError.
+	ErrLocked = errors.New("engine: database locked by another process")
+
+	// ErrLockUnsupported is returned by Open on platforms where the
+	// database LOCK file cannot be locked.
+	ErrLockUnsupported = errors.New("engine: file locking unsupported on this platform")
+
+	// ErrWouldStall is returned by writes with WriteOptions.NoSlowdown
+	// instead of being delayed or stopped by Config.WriteStall.
+	ErrWouldStall = errors.New("engine: write would stall")
+
+	// ErrClosed is returned by every method of a closed Engine but Close.
+	ErrClosed = errors.New("engine: closed")
+
+	// ErrKeyTooLarge is returned by writes whose key exceeds Config.MaxKeySize.
+	ErrKeyTooLarge = errs.ErrKeyTooLarge
+
+	// ErrValueTooLarge is returned by writes whose value exceeds
+	// Config.MaxValueSize.
+	ErrValueTooLarge = errs.ErrValueTooLarge
+
+	// ErrEmptyKey is returned by writes with an empty or nil key.
+	ErrEmptyKey = errors.New("engine: empty key")
+
+	// ErrNotFound is returned by Lookup for a missing or deleted key.
+	ErrNotFound = errors.New("engine: key not found")
+
+	// ErrCorruption matches every *CorruptionError, returned when a WAL or
+	// SSTable cannot be decoded.
+	ErrCorruption = errs.ErrCorruption
+)
+
+// CorruptionError reports damaged on-disk data with its file and offset.
+type CorruptionError = errs.CorruptionError
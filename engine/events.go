@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"sync"
+
+	"vern_kv/config"
+)
+
+// eventQueue delivers events to the configured EventListener from its own
+// goroutine, so callbacks never run under e.mu. push never blocks.
+// A nil *eventQueue (no listener) drops every event.
+type eventQueue struct {
+	listener config.EventListener
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []func(config.EventListener)
+	closed  bool
+	done    chan struct{}
+}
+
+// starts delivering to l; returns nil when l is nil.
+func newEventQueue(l config.EventListener) *eventQueue {
+	if l == nil {
+		return nil
+	}
+
+	q := &eventQueue{listener: l, done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// queues one callback.
+func (q *eventQueue) push(fn func(config.EventListener)) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	if !q.closed {
+		q.pending = append(q.pending, fn)
+		q.cond.Signal()
+	}
+	q.mu.Unlock()
+}
+
+func (q *eventQueue) run() {
+	defer close(q.done)
+
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		batch := q.pending
+		q.pending = nil
+		closed := q.closed
+		q.mu.Unlock()
+
+		for _, fn := range batch {
+			fn(q.listener)
+		}
+		if closed && len(batch) == 0 {
+			return
+		}
+	}
+}
+
+// delivers the queued events and stops. Must not be called with e.mu held
+// by the engine owning q, nor from a callback, which would wait for itself.
+func (q *eventQueue) close() {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Signal()
+	q.mu.Unlock()
+
+	<-q.done
+}
+
+func (q *eventQueue) flushBegin(info config.FlushInfo) {
+	q.push(func(l config.EventListener) { l.OnFlushBegin(info) })
+}
+
+func (q *eventQueue) flushCompleted(info config.FlushInfo) {
+	q.push(func(l config.EventListener) { l.OnFlushCompleted(info) })
+}
+
+func (q *eventQueue) tableFileCreated(info config.TableFileInfo) {
+	q.push(func(l config.EventListener) { l.OnTableFileCreated(info) })
+}
+
+func (q *eventQueue) tableFileDeleted(info config.TableFileInfo) {
+	q.push(func(l config.EventListener) { l.OnTableFileDeleted(info) })
+}
+
+func (q *eventQueue) backgroundError(err error) {
+	q.push(func(l config.EventListener) { l.OnBackgroundError(err) })
+}
+
+func (q *eventQueue) writeStall(info config.WriteStallInfo) {
+	q.push(func(l config.EventListener) { l.OnWriteStall(info) })
+}
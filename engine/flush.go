@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"slices"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/memtable"
+	"vern_kv/sstable"
+	"vern_kv/stats"
+)
+
+// Flush freezes the active memtable of every column family and writes it
+// to an SSTable, e.g. before a backup. With wait=false the flush runs in
+// the background and Flush returns at once; Close waits for it, and a
+// failure is counted in the vern.background-errors property.
+// Reads and writes go on while the tables are written.
+func (e *Engine) Flush(wait bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+
+	if wait {
+		return e.flushAll()
+	}
+
+	// frozen now, so that Close writes them even before the flush starts
+	for _, cf := range e.cfs {
+		cf.freeze()
+	}
+	e.bg.Add(1)
+	go func() {
+		defer e.bg.Done()
+
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if err := e.flushAll(); err != nil {
+			e.backgroundFailed("background flush failed", err)
+		}
+	}()
+	return nil
+}
+
+// counts, logs and reports the failure of work no caller waits for.
+// Caller must hold e.mu.
+func (e *Engine) backgroundFailed(msg string, err error) {
+	e.bgErrors++
+	e.log.Error(msg, "err", err)
+	e.events.backgroundError(err)
+}
+
+// flushes the active memtables, stopping at the first failure.
+// Caller must hold e.mu; see flush.
+func (e *Engine) flushAll() error {
+	for _, cf := range e.liveColumnFamilies() {
+		if err := e.flush(cf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushes the active memtable of cf once it is full. The write that filled
+// it is already logged and applied, so a failed flush is reported like one
+// of Flush(false) rather than to the writer; the memtable stays frozen for
+// the next flush to retry. Caller must hold e.mu; see flush.
+func (e *Engine) maybeFlush(cf *ColumnFamily) {
+	if cf.active.ApproximateSize() < cf.opts.MemtableSizeBytes {
+		return
+	}
+	if err := e.flush(cf); err != nil {
+		e.backgroundFailed("flush failed", err)
+	}
+}
+
+// freezes the active memtable of cf and returns once it and every older
+// frozen memtable are written to tables.
+//
+// Caller must hold e.mu, which is released while a table is written, so
+// that reads and writes (throttled by Config.RateLimiter or not) go on
+// meanwhile. The frozen memtables of a column family are written one at a
+// time, oldest first; after a failed write the memtable stays frozen and
+// readable, and is written first by the next flush.
+func (e *Engine) flush(cf *ColumnFamily) error {
+	cf.freeze()
+	return e.flushFrozen(cf)
+}
+
+// returns once the memtables of cf frozen so far are written to tables.
+// Caller must hold e.mu; see flush.
+func (e *Engine) flushFrozen(cf *ColumnFamily) error {
+	if len(cf.frozen) == 0 {
+		return nil
+	}
+	last := cf.frozen[len(cf.frozen)-1]
+
+	for slices.Contains(cf.frozen, last) {
+		// Close writes the frozen memtables left
+		if e.closed || cf.dropped {
+			return nil
+		}
+		if cf.flushing {
+			e.waitBackground()
+			continue
+		}
+		if err := e.flushOldest(cf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writes the oldest frozen memtable of cf to a table without e.mu, then
+// installs it. Caller must hold e.mu, and cf must not be flushing.
+func (e *Engine) flushOldest(cf *ColumnFamily) error {
+	mt := cf.frozen[0]
+	cf.flushing = true
+	e.mu.Unlock()
+
+	info, err := cf.writeMemtable(mt)
+
+	e.mu.Lock()
+	cf.flushing = false
+	e.wakeBackground()
+	if err != nil {
+		return err
+	}
+
+	cf.installFlush(info)
+	e.stallRelief()
+	return nil
+}
+
+// writes the frozen memtables, and with all the active ones too, to tables
+// without releasing e.mu. Used by Close once no other table write runs.
+func (e *Engine) flushOnClose(all bool) error {
+	for _, cf := range e.cfs {
+		if all {
+			cf.freeze()
+		}
+		for len(cf.frozen) > 0 {
+			info, err := cf.writeMemtable(cf.frozen[0])
+			if err != nil {
+				return err
+			}
+			cf.installFlush(info)
+		}
+	}
+	return nil
+}
+
+// returns the live column families, so that they can be walked while
+// e.mu is released. Caller must hold e.mu.
+func (e *Engine) liveColumnFamilies() []*ColumnFamily {
+	cfs := make([]*ColumnFamily, 0, len(e.cfs))
+	for _, cf := range e.cfs {
+		cfs = append(cfs, cf)
+	}
+	return cfs
+}
+
+// waits for a table write running without e.mu to end. Caller must hold
+// e.mu, which is released meanwhile.
+func (e *Engine) waitBackground() {
+	wake := e.bgWake
+	e.mu.Unlock()
+	<-wake
+	e.mu.Lock()
+}
+
+// wakes the callers of waitBackground. Caller must hold e.mu.
+func (e *Engine) wakeBackground() {
+	close(e.bgWake)
+	e.bgWake = make(chan struct{})
+}
+
+// reports whether a flush or compaction writes a table without e.mu.
+// Caller must hold e.mu.
+func (e *Engine) writingTables() bool {
+	for _, cf := range e.cfs {
+		if cf.flushing || cf.compacting {
+			return true
+		}
+	}
+	return false
+}
+
+// moves the active memtable, unless it is empty, to the frozen ones.
+// Caller must hold e.mu.
+func (cf *ColumnFamily) freeze() {
+	if cf.active.Len() == 0 && len(cf.active.RangeTombstones()) == 0 {
+		return
+	}
+	cf.frozen = append(cf.frozen, cf.active)
+	cf.active = cf.newMemtable()
+}
+
+// returns the memtables of cf, newest first. Caller must hold e.mu.
+func (cf *ColumnFamily) memtables() []*memtable.Memtable {
+	mts := []*memtable.Memtable{cf.active}
+	for i := len(cf.frozen) - 1; i >= 0; i-- {
+		mts = append(mts, cf.frozen[i])
+	}
+	return mts
+}
+
+// replaces the oldest frozen memtable by the table it was written to
+// (nil when it held nothing to write). Caller must hold e.mu.
+func (cf *ColumnFamily) installFlush(info *tableInfo) {
+	cf.frozen = slices.Delete(cf.frozen, 0, 1)
+	if info != nil {
+		cf.sstables = append(cf.sstables, info)
+	}
+}
+
+// writes the frozen memtable mt to a new table, returning nil when it
+// holds nothing to write. Reads only immutable state, so it runs without
+// e.mu.
+func (cf *ColumnFamily) writeMemtable(mt *memtable.Memtable) (*tableInfo, error) {
+	dels := mt.RangeTombstones()
+	entries := cf.dropCovered(mt.AllEntriesSorted(), dels)
+	if len(entries) == 0 && len(dels) == 0 {
+		return nil, nil
+	}
+	defer cf.stats.Since(stats.FlushLatency, cf.stats.Start())
+	start := time.Now()
+
+	flush := config.FlushInfo{ColumnFamily: cf.name, Entries: len(entries)}
+	flush.MinSeq, flush.MaxSeq = sstable.SeqRange(entries, dels)
+	cf.events.flushBegin(flush)
+
+	// Expired values are dropped; a tombstone keeps older versions hidden.
+	now := cf.now().UnixNano()
+	for i, entry := range entries {
+		if entry.Expired(now) {
+			entries[i] = sstable.Entry{Key: entry.Key, Seq: entry.Seq, Tombstone: true}
+		}
+	}
+
+	info, err := cf.writeTable(entries, dels, flush.MinSeq, flush.MaxSeq)
+	if err != nil {
+		cf.log.Error("flush failed", "cf", cf.name, "entries", len(entries), "err", err)
+		return nil, err
+	}
+
+	cf.log.Info("flush",
+		"cf", cf.name,
+		"path", info.path,
+		"entries", len(entries),
+		"bytes", info.size,
+		"min_seq", flush.MinSeq,
+		"max_seq", flush.MaxSeq,
+		"duration", time.Since(start))
+	cf.stats.Add(stats.Flushes, 1)
+
+	flush.Path = info.path
+	cf.events.flushCompleted(flush)
+	return info, nil
+}
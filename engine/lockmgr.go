@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+type lockMode int
+
+const (
+	lockShared lockMode = iota + 1
+	lockExclusive
+)
+
+// keyLock tracks the holders of one key.
+// wake is closed (and replaced) whenever a holder releases the key.
+type keyLock struct {
+	holders map[uint64]lockMode
+	wake    chan struct{}
+}
+
+// compatible reports whether txn may take the key in mode.
+func (kl *keyLock) compatible(txn uint64, mode lockMode) bool {
+	for id, held := range kl.holders {
+		if id == txn {
+			continue
+		}
+		if mode == lockExclusive || held == lockExclusive {
+			return false
+		}
+	}
+	return true
+}
+
+// lockManager grants per-key shared/exclusive locks to transactions.
+// Blocked transactions are recorded in a wait-for graph; a request that
+// would close a cycle fails with ErrDeadlock instead of waiting.
+type lockManager struct {
+	mu       sync.Mutex
+	locks    map[string]*keyLock
+	waitsFor map[uint64][]uint64
+	nextID   uint64
+}
+
+func newLockManager() *lockManager {
+	return &lockManager{
+		locks:    make(map[string]*keyLock),
+		waitsFor: make(map[uint64][]uint64),
+	}
+}
+
+// returns a fresh transaction id.
+func (lm *lockManager) newTxnID() uint64 {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.nextID++
+	return lm.nextID
+}
+
+// acquire blocks until txn holds key in mode, the timeout expires
+// (ErrLockTimeout) or waiting would deadlock (ErrDeadlock).
+// Holding a shared lock and asking for exclusive upgrades it.
+func (lm *lockManager) acquire(txn uint64, key string, mode lockMode, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	lm.mu.Lock()
+	for {
+		kl, ok := lm.locks[key]
+		if !ok {
+			kl = &keyLock{
+				holders: make(map[uint64]lockMode),
+				wake:    make(chan struct{}),
+			}
+			lm.locks[key] = kl
+		}
+
+		if kl.compatible(txn, mode) {
+			if kl.holders[txn] < mode {
+				kl.holders[txn] = mode
+			}
+			delete(lm.waitsFor, txn)
+			lm.mu.Unlock()
+			return nil
+		}
+
+		var blockers []uint64
+		for id := range kl.holders {
+			if id != txn {
+				blockers = append(blockers, id)
+			}
+		}
+		lm.waitsFor[txn] = blockers
+
+		if lm.reaches(blockers, txn, make(map[uint64]bool)) {
+			delete(lm.waitsFor, txn)
+			lm.mu.Unlock()
+			return ErrDeadlock
+		}
+
+		wake := kl.wake
+		lm.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-timer.C:
+			lm.mu.Lock()
+			delete(lm.waitsFor, txn)
+			lm.mu.Unlock()
+			return ErrLockTimeout
+		}
+
+		lm.mu.Lock()
+	}
+}
+
+// reports whether target is reachable from any of from in the wait-for graph.
+func (lm *lockManager) reaches(from []uint64, target uint64, seen map[uint64]bool) bool {
+	for _, id := range from {
+		if id == target {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if lm.reaches(lm.waitsFor[id], target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// release drops every lock txn holds on keys and wakes their waiters.
+func (lm *lockManager) release(txn uint64, keys []string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	for _, key := range keys {
+		kl, ok := lm.locks[key]
+		if !ok {
+			continue
+		}
+		delete(kl.holders, txn)
+		close(kl.wake)
+		kl.wake = make(chan struct{})
+
+		if len(kl.holders) == 0 {
+			delete(lm.locks, key)
+		}
+	}
+	delete(lm.waitsFor, txn)
+}
@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"vern_kv/config"
+)
+
+const (
+	// the current log file in DataDir; rotated ones are LOG.old.<unix nanos>
+	logFileName = "LOG"
+
+	// a LOG file reaching this size is rotated
+	maxLogFileSize = 16 << 20 // 16MB
+
+	// rotated LOG files kept, oldest deleted first
+	keepLogFiles = 5
+)
+
+// returns cfg.Logger, or a JSON logger writing to the rotating LOG file
+// of DataDir. The returned closer (nil for cfg.Logger) closes the file.
+func openLogger(cfg config.Config) (*slog.Logger, io.Closer, error) {
+	if cfg.Logger != nil {
+		return cfg.Logger, nil, nil
+	}
+
+	lf, err := openLogFile(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(slog.NewJSONHandler(lf, nil)), lf, nil
+}
+
+// returns cfg.Logger, or a logger discarding everything; read-only engines
+// do not write to DataDir.
+func readOnlyLogger(cfg config.Config) *slog.Logger {
+	if cfg.Logger != nil {
+		return cfg.Logger
+	}
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// logFile is the LOG file of a data directory. A previous LOG is rotated
+// away when it is opened, and the file is rotated whenever it reaches
+// maxLogFileSize.
+type logFile struct {
+	dir string
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openLogFile(dir string) (*logFile, error) {
+	lf := &logFile{dir: dir}
+	if err := lf.rotate(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.size+int64(len(p)) > maxLogFileSize && lf.size > 0 {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// moves the current LOG aside, drops the oldest rotated files and starts
+// an empty LOG. Caller must hold lf.mu (or be opening lf).
+func (lf *logFile) rotate() error {
+	if lf.f != nil {
+		lf.f.Close()
+		lf.f = nil
+	}
+
+	path := filepath.Join(lf.dir, logFileName)
+	if _, err := os.Stat(path); err == nil {
+		old := fmt.Sprintf("%s.old.%d", path, time.Now().UnixNano())
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+
+	rotated, err := filepath.Glob(path + ".old.*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(rotated)
+	for len(rotated) > keepLogFiles {
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	lf.f = f
+	lf.size = 0
+	return nil
+}
+
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.f.Close()
+}
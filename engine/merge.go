@@ -0,0 +1,95 @@
+package engine
+
+import "vern_kv/sstable"
+
+// Merge records operand for key without reading the current value.
+// The configured MergeOperator folds operands on reads, flushes and Compact.
+func (e *Engine) Merge(key, operand []byte) error {
+	if e.cfg.MergeOperator == nil {
+		return ErrNoMergeOperator
+	}
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkEntry(key, operand); err != nil {
+		return err
+	}
+
+	e.seq++
+	if err := e.wal.AppendMerge(e.seq, key, operand); err != nil {
+		e.seq--
+		return err
+	}
+
+	e.def.active.Merge(key, operand, e.seq)
+	e.recordWrite(key, operand)
+	e.maybeFlush(e.def)
+	return nil
+}
+
+// resolve folds the versions of one key (newest first) into its current entry.
+// Merge entries collect operands until a value or tombstone (or the end of
+// versions) provides the base. The result keeps the newest sequence number.
+// An expired value resolves to a tombstone, and versions older than a
+// covering range tombstone are replaced by a tombstone at its sequence.
+func (cf *ColumnFamily) resolve(versions []sstable.Entry) (sstable.Entry, bool, error) {
+	return cf.resolveWith(versions, cf.rangeTombstones())
+}
+
+// is resolve against the range tombstones dels, for callers working on a
+// snapshot without e.mu.
+func (cf *ColumnFamily) resolveWith(versions []sstable.Entry, dels []sstable.RangeTombstone) (sstable.Entry, bool, error) {
+	if len(versions) == 0 {
+		return sstable.Entry{}, false, nil
+	}
+
+	if cover := sstable.MaxCoveringSeq(cf.cmp, dels, versions[0].Key); cover > 0 {
+		for i, v := range versions {
+			if v.Seq < cover {
+				versions = append(versions[:i:i], sstable.Entry{Key: v.Key, Seq: cover, Tombstone: true})
+				break
+			}
+		}
+	}
+
+	now := cf.now().UnixNano()
+
+	top := versions[0]
+	if !top.Merge {
+		if top.Expired(now) {
+			return sstable.Entry{Key: top.Key, Seq: top.Seq, Tombstone: true}, true, nil
+		}
+		return top, true, nil
+	}
+
+	if cf.opts.MergeOperator == nil {
+		return sstable.Entry{}, false, ErrNoMergeOperator
+	}
+
+	var (
+		operands [][]byte
+		base     []byte
+	)
+	for _, v := range versions {
+		if !v.Merge {
+			if !v.Tombstone && !v.Expired(now) {
+				base = v.Value
+			}
+			break
+		}
+		operands = append(append([][]byte(nil), v.Operands...), operands...)
+	}
+
+	return sstable.Entry{
+		Key:   top.Key,
+		Value: cf.opts.MergeOperator.FullMerge(top.Key, base, operands),
+		Seq:   top.Seq,
+	}, true, nil
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+
+	"vern_kv/sstable"
+)
+
+// batches with fewer pending keys are probed sequentially
+const multiGetParallelThreshold = 256
+
+// MultiGetOptions configures MultiGetWithOptions.
+type MultiGetOptions struct {
+	// number of goroutines probing each table for large batches
+	// (0 or 1 = sequential)
+	Parallelism int
+}
+
+// MultiGet looks up keys in one consistent view and returns their values
+// and presence in input order.
+//
+// The memtables are probed once per key; each SSTable that may hold a
+// remaining key is then opened once and probed for all of them in key order.
+func (e *Engine) MultiGet(keys [][]byte) ([][]byte, []bool, error) {
+	return e.MultiGetWithOptions(keys, MultiGetOptions{})
+}
+
+// MultiGetWithOptions is MultiGet with options.
+func (e *Engine) MultiGetWithOptions(keys [][]byte, opts MultiGetOptions) ([][]byte, []bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkOpen(); err != nil {
+		return nil, nil, err
+	}
+	return e.def.multiGet(keys, opts)
+}
+
+// lookup is the state of one MultiGet key.
+type lookup struct {
+	key      []byte
+	versions []sstable.Entry // newest first
+	done     bool            // a non-merge version was found
+}
+
+// adds a version; a non-merge version ends the search.
+func (l *lookup) add(entry sstable.Entry) {
+	l.versions = append(l.versions, entry)
+	l.done = !entry.Merge
+}
+
+func (cf *ColumnFamily) multiGet(keys [][]byte, opts MultiGetOptions) ([][]byte, []bool, error) {
+	lookups := make([]lookup, len(keys))
+	for i, key := range keys {
+		lookups[i].key = key
+	}
+
+	// key order, for sequential table probes
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return cf.cmp.Compare(keys[order[a]], keys[order[b]]) < 0
+	})
+
+	// 1. Memtables (newest first)
+	for _, mt := range cf.memtables() {
+		for i := range lookups {
+			l := &lookups[i]
+			if l.done {
+				continue
+			}
+			if entry, ok := mt.Get(l.key); ok {
+				l.add(memtableToSSTable(entry))
+			}
+		}
+	}
+
+	// 2. SSTables (newest → oldest), each opened once
+	for i := len(cf.sstables) - 1; i >= 0; i-- {
+		t := cf.sstables[i]
+
+		var pending []int
+		for _, idx := range order {
+			if !lookups[idx].done && cf.tableMayContainKey(t, lookups[idx].key) {
+				pending = append(pending, idx)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		st, err := cf.openTable(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = probeTable(st, lookups, pending, opts.Parallelism)
+		cf.closeTable(t, st)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+	for i := range lookups {
+		entry, ok, err := cf.resolve(lookups[i].versions)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok && !entry.Tombstone {
+			values[i] = entry.Value
+			found[i] = true
+		}
+	}
+
+	return values, found, nil
+}
+
+// looks up the pending keys (in key order) in st, splitting them across
+// workers when the batch is large enough.
+func probeTable(st *sstable.SSTable, lookups []lookup, pending []int, workers int) error {
+	probe := func(idxs []int) error {
+		for _, idx := range idxs {
+			entry, ok, err := st.Get(lookups[idx].key)
+			if err != nil {
+				return err
+			}
+			if ok {
+				lookups[idx].add(entry)
+			}
+		}
+		return nil
+	}
+
+	if workers <= 1 || len(pending) < multiGetParallelThreshold {
+		return probe(pending)
+	}
+
+	chunk := (len(pending) + workers - 1) / workers
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo := w * chunk
+		if lo >= len(pending) {
+			break
+		}
+		hi := min(lo+chunk, len(pending))
+
+		wg.Add(1)
+		go func(w int, idxs []int) {
+			defer wg.Done()
+			errs[w] = probe(idxs)
+		}(w, pending[lo:hi])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
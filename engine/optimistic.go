@@ -0,0 +1,121 @@
+package engine
+
+import "vern_kv/wal"
+
+// OptimisticTxn buffers writes and validates its reads at commit time.
+//
+// Every key read through the transaction records the sequence number of the
+// version it observed (0 if absent). Commit fails with ErrConflict if any of
+// those keys has a different newest sequence by then; otherwise the buffered
+// writes are committed as one WAL batch.
+type OptimisticTxn struct {
+	eng *Engine
+
+	reads  map[string]uint64
+	writes []wal.Entry
+	latest map[string]int // key → index of its newest buffered write
+
+	done bool
+}
+
+// BeginOptimistic starts an optimistic transaction.
+func (e *Engine) BeginOptimistic() *OptimisticTxn {
+	return &OptimisticTxn{
+		eng:    e,
+		reads:  make(map[string]uint64),
+		latest: make(map[string]int),
+	}
+}
+
+// Get returns the value of key, seeing the transaction's own writes first.
+func (t *OptimisticTxn) Get(key []byte) ([]byte, bool, error) {
+	if t.done {
+		return nil, false, ErrTxnDone
+	}
+
+	if i, ok := t.latest[string(key)]; ok {
+		w := t.writes[i]
+		if w.Tombstone {
+			return nil, false, nil
+		}
+		return w.Value, true, nil
+	}
+
+	t.eng.mu.Lock()
+	entry, ok, err := t.eng.getEntry(key)
+	t.eng.mu.Unlock()
+	if err != nil {
+		return nil, false, err
+	}
+
+	// keep the first observation; a later one cannot make the read valid
+	if _, seen := t.reads[string(key)]; !seen {
+		t.reads[string(key)] = entry.Seq
+	}
+
+	if !ok || entry.Tombstone {
+		return nil, false, nil
+	}
+	return entry.Value, true, nil
+}
+
+// Put buffers a PUT. key and value are copied.
+func (t *OptimisticTxn) Put(key, value []byte) error {
+	return t.buffer(wal.Entry{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), value...),
+	})
+}
+
+// Delete buffers a DELETE. key is copied.
+func (t *OptimisticTxn) Delete(key []byte) error {
+	return t.buffer(wal.Entry{
+		Key:       append([]byte(nil), key...),
+		Tombstone: true,
+	})
+}
+
+func (t *OptimisticTxn) buffer(w wal.Entry) error {
+	if t.done {
+		return ErrTxnDone
+	}
+
+	t.latest[string(w.Key)] = len(t.writes)
+	t.writes = append(t.writes, w)
+	return nil
+}
+
+// Commit validates the read set and atomically applies the buffered writes.
+// The transaction is finished afterwards, whether or not Commit succeeded.
+func (t *OptimisticTxn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+
+	e := t.eng
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for k, seq := range t.reads {
+		entry, _, err := e.getEntry([]byte(k))
+		if err != nil {
+			return err
+		}
+		if entry.Seq != seq {
+			return ErrConflict
+		}
+	}
+
+	return e.writeBatch(t.writes)
+}
+
+// Rollback discards the buffered writes.
+func (t *OptimisticTxn) Rollback() {
+	t.done = true
+	t.writes = nil
+}
@@ -0,0 +1,137 @@
+package engine
+
+import "vern_kv/wal"
+
+// PessimisticTxn locks keys as it touches them.
+//
+// Reads take a shared lock, GetForUpdate and writes take an exclusive lock.
+// Locks are held until Commit or Rollback. A lock that cannot be granted
+// within Config.LockTimeout fails with ErrLockTimeout, and one whose wait
+// would deadlock fails with ErrDeadlock; the caller should then Rollback.
+//
+// Plain Engine.Put/Delete do not take key locks.
+type PessimisticTxn struct {
+	eng *Engine
+	id  uint64
+
+	held   map[string]lockMode
+	writes []wal.Entry
+	latest map[string]int // key → index of its newest buffered write
+
+	done bool
+}
+
+// BeginPessimistic starts a pessimistic transaction.
+func (e *Engine) BeginPessimistic() *PessimisticTxn {
+	return &PessimisticTxn{
+		eng:    e,
+		id:     e.locks.newTxnID(),
+		held:   make(map[string]lockMode),
+		latest: make(map[string]int),
+	}
+}
+
+// Get returns the value of key under a shared lock.
+func (t *PessimisticTxn) Get(key []byte) ([]byte, bool, error) {
+	return t.get(key, lockShared)
+}
+
+// GetForUpdate returns the value of key under an exclusive lock.
+func (t *PessimisticTxn) GetForUpdate(key []byte) ([]byte, bool, error) {
+	return t.get(key, lockExclusive)
+}
+
+func (t *PessimisticTxn) get(key []byte, mode lockMode) ([]byte, bool, error) {
+	if err := t.lock(key, mode); err != nil {
+		return nil, false, err
+	}
+
+	if i, ok := t.latest[string(key)]; ok {
+		w := t.writes[i]
+		if w.Tombstone {
+			return nil, false, nil
+		}
+		return w.Value, true, nil
+	}
+
+	return t.eng.Get(key)
+}
+
+// Put buffers a PUT under an exclusive lock. key and value are copied.
+func (t *PessimisticTxn) Put(key, value []byte) error {
+	return t.buffer(wal.Entry{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), value...),
+	})
+}
+
+// Delete buffers a DELETE under an exclusive lock. key is copied.
+func (t *PessimisticTxn) Delete(key []byte) error {
+	return t.buffer(wal.Entry{
+		Key:       append([]byte(nil), key...),
+		Tombstone: true,
+	})
+}
+
+func (t *PessimisticTxn) buffer(w wal.Entry) error {
+	if err := t.lock(w.Key, lockExclusive); err != nil {
+		return err
+	}
+
+	t.latest[string(w.Key)] = len(t.writes)
+	t.writes = append(t.writes, w)
+	return nil
+}
+
+// takes key in mode unless already held at least that strongly.
+func (t *PessimisticTxn) lock(key []byte, mode lockMode) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if t.held[string(key)] >= mode {
+		return nil
+	}
+
+	if err := t.eng.locks.acquire(t.id, string(key), mode, t.eng.cfg.LockTimeoutOrDefault()); err != nil {
+		return err
+	}
+	t.held[string(key)] = mode
+	return nil
+}
+
+// Commit applies the buffered writes as one WAL batch and releases all locks.
+func (t *PessimisticTxn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	defer t.finish()
+
+	if err := t.eng.throttle(); err != nil {
+		return err
+	}
+
+	t.eng.mu.Lock()
+	defer t.eng.mu.Unlock()
+
+	return t.eng.writeBatch(t.writes)
+}
+
+// Rollback discards the buffered writes and releases all locks.
+func (t *PessimisticTxn) Rollback() {
+	if t.done {
+		return
+	}
+	t.finish()
+}
+
+func (t *PessimisticTxn) finish() {
+	t.done = true
+	t.writes = nil
+
+	keys := make([]string, 0, len(t.held))
+	for k := range t.held {
+		keys = append(keys, k)
+	}
+	t.eng.locks.release(t.id, keys)
+	t.held = nil
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"context"
+
+	"vern_kv/sstable"
+)
+
+// prefixScan merges the sources of one column family into its live
+// entries under a prefix, in comparator order.
+//
+// It is set up under e.mu and read without it: the memtable entries under
+// the prefix are copied, and tables are read lazily through handles
+// acquired at setup, so a scan stopped early reads no further.
+type prefixScan struct {
+	cf   *ColumnFamily
+	dels []sstable.RangeTombstone
+	srcs []*scanSource // newest first
+}
+
+// scanSource is one sorted input of a prefixScan.
+type scanSource struct {
+	mem []sstable.Entry // copied memtable entries, or
+
+	t      *tableInfo // a table read through it
+	st     *sstable.SSTable
+	it     *sstable.Iterator
+	pinned bool
+
+	head sstable.Entry
+	ok   bool // head is valid
+}
+
+// moves head to the next entry of the source.
+func (s *scanSource) advance() error {
+	if s.it == nil {
+		s.ok = len(s.mem) > 0
+		if s.ok {
+			s.head, s.mem = s.mem[0], s.mem[1:]
+		}
+		return nil
+	}
+
+	var err error
+	s.head, s.ok, err = s.it.Next()
+	return err
+}
+
+// runs a prefix scan of cf, calling fn without e.mu held and giving up
+// with ctx.Err() while it sets up or between two calls of fn.
+func (e *Engine) scanPrefix(ctx context.Context, cf *ColumnFamily, prefix []byte, fn func(key, value []byte) bool) error {
+	if err := e.lockCtx(ctx); err != nil {
+		return err
+	}
+	if err := e.checkOpen(); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if err := e.checkColumnFamily(cf); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	scan, err := cf.newPrefixScan(prefix)
+	e.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	defer e.closeScan(scan)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry, ok, err := scan.next()
+		if err != nil {
+			return err
+		}
+		if !ok || !fn(entry.Key, entry.Value) {
+			return nil
+		}
+	}
+}
+
+// sets up a scan of the keys starting with prefix. Tables whose prefix
+// filter excludes prefix are skipped without being opened.
+// Caller must hold e.mu.
+func (cf *ColumnFamily) newPrefixScan(prefix []byte) (*prefixScan, error) {
+	scan := &prefixScan{cf: cf, dels: cf.rangeTombstones()}
+
+	// 1. Memtables
+	for _, mt := range cf.memtables() {
+		src := &scanSource{}
+		for _, me := range mt.ScanPrefix(prefix) {
+			src.mem = append(src.mem, memtableToSSTable(me))
+		}
+		scan.srcs = append(scan.srcs, src)
+	}
+
+	// 2. SSTables (newest → oldest)
+	for i := len(cf.sstables) - 1; i >= 0; i-- {
+		t := cf.sstables[i]
+		if !t.filter.MayContain(prefix) {
+			continue
+		}
+
+		src := &scanSource{t: t, pinned: t.pinned != nil}
+		st, err := cf.acquireTable(t)
+		if err != nil {
+			scan.release()
+			return nil, err
+		}
+		src.st = st
+		src.it = st.NewPrefixIterator(prefix)
+		scan.srcs = append(scan.srcs, src)
+	}
+
+	for _, src := range scan.srcs {
+		if err := src.advance(); err != nil {
+			scan.release()
+			return nil, err
+		}
+	}
+	return scan, nil
+}
+
+// returns the next live entry of the scan; ok is false at the end.
+func (s *prefixScan) next() (entry sstable.Entry, ok bool, err error) {
+	for {
+		var key []byte
+		found := false
+		for _, src := range s.srcs {
+			if src.ok && (!found || s.cf.cmp.Compare(src.head.Key, key) < 0) {
+				key, found = src.head.Key, true
+			}
+		}
+		if !found {
+			return sstable.Entry{}, false, nil
+		}
+
+		// the versions of key, newest source first
+		var versions []sstable.Entry
+		for _, src := range s.srcs {
+			if src.ok && s.cf.cmp.Compare(src.head.Key, key) == 0 {
+				versions = append(versions, src.head)
+				if err := src.advance(); err != nil {
+					return sstable.Entry{}, false, err
+				}
+			}
+		}
+
+		entry, ok, err := s.cf.resolveWith(versions, s.dels)
+		if err != nil {
+			return sstable.Entry{}, false, err
+		}
+		if ok && !entry.Tombstone {
+			return entry, true, nil
+		}
+	}
+}
+
+// releases the tables of the scan. Caller must hold e.mu.
+func (s *prefixScan) release() {
+	for _, src := range s.srcs {
+		if src.st != nil {
+			s.cf.releaseTable(src.t, src.st, src.pinned)
+			src.st = nil
+		}
+	}
+}
+
+// releases the tables of a finished scan.
+func (e *Engine) closeScan(s *prefixScan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s.release()
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Property names understood by GetProperty. Counts cover every column family.
+const (
+	// number of SSTables
+	PropNumSSTables = "vern.num-sstables"
+	// approximate bytes held by active and frozen memtables
+	PropMemtableBytes = "vern.memtable-bytes"
+	// frozen memtables waiting to be written
+	PropNumImmutableMemtables = "vern.num-immutable-memtables"
+	// sequence number of the newest write
+	PropLastSequence = "vern.last-sequence"
+	// size of the WAL file
+	PropWALBytes = "vern.wal-bytes"
+	// entries in memtables and SSTables; overwritten and deleted keys
+	// are counted once per version
+	PropEstimateNumKeys = "vern.estimate-num-keys"
+	// one line per SSTable: column family, file, size, entries and
+	// sequence range
+	PropSSTableSummary = "vern.sstable-summary"
+	// background flushes that failed
+	PropBackgroundErrors = "vern.background-errors"
+)
+
+// GetProperty returns the value of a property of the engine, computed
+// from one consistent view of its current state. ok is false for unknown
+// names and on a closed engine.
+func (e *Engine) GetProperty(name string) (value string, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.checkOpen() != nil {
+		return "", false
+	}
+
+	var n int64
+	switch name {
+	case PropNumSSTables:
+		for _, cf := range e.cfs {
+			n += int64(len(cf.sstables))
+		}
+	case PropMemtableBytes:
+		for _, cf := range e.cfs {
+			for _, mt := range cf.memtables() {
+				n += mt.ApproximateSize()
+			}
+		}
+	case PropNumImmutableMemtables:
+		for _, cf := range e.cfs {
+			n += int64(len(cf.frozen))
+		}
+	case PropLastSequence:
+		return strconv.FormatUint(e.seq, 10), true
+	case PropWALBytes:
+		size, err := e.wal.Size()
+		if err != nil {
+			return "", false
+		}
+		n = size
+	case PropEstimateNumKeys:
+		for _, cf := range e.cfs {
+			for _, mt := range cf.memtables() {
+				n += int64(mt.Len())
+			}
+			for _, t := range cf.sstables {
+				n += int64(t.entries)
+			}
+		}
+	case PropSSTableSummary:
+		return e.sstableSummary(), true
+	case PropBackgroundErrors:
+		n = int64(e.bgErrors)
+	default:
+		return "", false
+	}
+	return strconv.FormatInt(n, 10), true
+}
+
+// formats PropSSTableSummary, column families by id and their tables
+// oldest first. Caller must hold e.mu.
+func (e *Engine) sstableSummary() string {
+	ids := make([]uint32, 0, len(e.cfs))
+	for id := range e.cfs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "cf\tfile\tsize\tentries\tseqs")
+	for _, id := range ids {
+		cf := e.cfs[id]
+		for _, t := range cf.sstables {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d-%d\n",
+				cf.name, filepath.Base(t.path), t.size, t.entries, t.minSeq, t.maxSeq)
+		}
+	}
+	tw.Flush()
+	return b.String()
+}
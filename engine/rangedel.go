@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"vern_kv/errs"
+	"vern_kv/sstable"
+	"vern_kv/wal"
+)
+
+// DeleteRange deletes every key in [start, end) with a single range
+// tombstone. Reads treat covered keys as deleted; Compact drops the
+// covered data.
+func (e *Engine) DeleteRange(start, end []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkRange(start, end); err != nil {
+		return err
+	}
+
+	e.seq++
+	if err := e.wal.AppendRangeDelete(e.seq, start, end); err != nil {
+		e.seq--
+		return err
+	}
+
+	e.def.active.DeleteRange(start, end, e.seq)
+	e.recordWrite(start, end)
+	e.maybeFlush(e.def)
+	return nil
+}
+
+// DeleteRangeCF is DeleteRange on column family cf.
+func (e *Engine) DeleteRangeCF(cf *ColumnFamily, start, end []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.writeCF(cf, wal.Entry{Key: start, Value: end, RangeDelete: true})
+}
+
+// validates the bounds of a range deletion; start may be empty.
+func (e *Engine) checkRange(start, end []byte) error {
+	maxKey := e.cfg.KeySizeLimit()
+	if err := errs.CheckSize(start, nil, maxKey, 0); err != nil {
+		return err
+	}
+	if err := errs.CheckSize(end, nil, maxKey, 0); err != nil {
+		return err
+	}
+	if e.cfg.KeyComparator().Compare(start, end) >= 0 {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// returns the range tombstones of every memtable and table.
+func (cf *ColumnFamily) rangeTombstones() []sstable.RangeTombstone {
+	var dels []sstable.RangeTombstone
+	for _, mt := range cf.memtables() {
+		dels = append(dels, mt.RangeTombstones()...)
+	}
+	for _, t := range cf.sstables {
+		dels = append(dels, t.dels...)
+	}
+	return dels
+}
+
+// drops the entries covered by a newer tombstone in dels.
+func (cf *ColumnFamily) dropCovered(entries []sstable.Entry, dels []sstable.RangeTombstone) []sstable.Entry {
+	if len(dels) == 0 {
+		return entries
+	}
+
+	var out []sstable.Entry
+	for _, entry := range entries {
+		if sstable.MaxCoveringSeq(cf.cmp, dels, entry.Key) > entry.Seq {
+			continue
+		}
+		out = append(out, entry)
+	}
+	return out
+}
@@ -0,0 +1,348 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/sstable"
+	"vern_kv/wal"
+)
+
+// OpenReadOnly opens an existing database for reading alongside its writer.
+//
+// It loads the SSTables of every column family and replays the WAL records
+// they do not hold into in-memory memtables; nothing is written to disk.
+// Writes return ErrReadOnly. TryCatchUp picks up the writer's later work.
+func OpenReadOnly(cfg config.Config) (*Engine, error) {
+	st := newStats(cfg)
+	w, err := wal.OpenWithOptions(cfg.WALDir(), walOptions(cfg, true, st))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Engine{
+		cfg:      cfg,
+		wal:      w,
+		stats:    st,
+		events:   newEventQueue(cfg.EventListener),
+		log:      readOnlyLogger(cfg),
+		cfs:      make(map[uint32]*ColumnFamily),
+		locks:    newLockManager(),
+		prepared: make(map[string][]wal.Entry),
+		readOnly: true,
+
+		bgWake: make(chan struct{}),
+	}
+
+	if err := e.catchUp(); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// TryCatchUp refreshes a read-only engine with the tables flushed and the
+// WAL records appended by the writer since the last call.
+// Existing ColumnFamily handles stay valid unless their family was dropped.
+func (e *Engine) TryCatchUp() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkOpen(); err != nil {
+		return err
+	}
+	if !e.readOnly {
+		return nil
+	}
+	return e.catchUp()
+}
+
+// rebuilds the read-only state from disk. Caller must hold e.mu.
+func (e *Engine) catchUp() error {
+	start := time.Now()
+
+	rec, err := e.wal.Recover(0)
+	if err != nil {
+		return err
+	}
+
+	stored := rec.Comparator
+	if stored == "" {
+		stored = config.BytewiseComparator.Name()
+	}
+	if cmp := e.cfg.KeyComparator(); stored != cmp.Name() {
+		return fmt.Errorf("%w: database uses %q, config has %q", ErrComparatorMismatch, stored, cmp.Name())
+	}
+
+	// column families
+	live := map[uint32]string{0: defaultColumnFamily}
+	for id, name := range rec.ColumnFamilies {
+		live[id] = name
+	}
+	for id, cf := range e.cfs {
+		if _, ok := live[id]; !ok {
+			cf.dropped = true
+			cf.unpinTables()
+			delete(e.cfs, id)
+		}
+	}
+	for id, name := range live {
+		if _, ok := e.cfs[id]; ok {
+			continue
+		}
+		if id == 0 {
+			e.def = e.newColumnFamily(0, name, e.cfg.DefaultColumnFamilyOptions(), e.cfg.SSTableDir())
+			continue
+		}
+		opts, err := recoveredOptions(e.cfg, name, rec.ColumnFamilyOptions[id])
+		if err != nil {
+			return err
+		}
+		e.newColumnFamily(id, name, opts, e.cfg.ColumnFamilyDir(id))
+	}
+	e.nextCF = rec.MaxColumnFamilyID + 1
+
+	// tables, and the sequence each column family has flushed up to
+	flushed := make(map[uint32]uint64)
+	for id, cf := range e.cfs {
+		if err := cf.pinTables(); err != nil {
+			return err
+		}
+		for _, t := range cf.sstables {
+			if s := t.pinned.MaxSeq(); s > flushed[id] {
+				flushed[id] = s
+			}
+		}
+		cf.active = cf.newMemtable()
+		cf.frozen = nil
+	}
+
+	// A flush writes every older entry of its column family, so only
+	// records above that column family's newest table need replaying.
+	var maxSeq uint64
+	var replayed int
+	for _, entry := range rec.Entries {
+		if entry.Seq <= maxSeq {
+			continue
+		}
+		maxSeq = entry.Seq
+
+		cf, ok := e.cfs[entry.CF]
+		if !ok || entry.Seq <= flushed[entry.CF] {
+			continue
+		}
+		if entry.Merge && cf.opts.MergeOperator == nil {
+			return ErrNoMergeOperator
+		}
+		applyEntry(cf, entry, entry.Seq)
+		replayed++
+	}
+	for _, s := range flushed {
+		if s > maxSeq {
+			maxSeq = s
+		}
+	}
+	e.seq = maxSeq
+
+	e.prepared = make(map[string][]wal.Entry)
+	for _, p := range rec.Prepared {
+		e.prepared[p.Name] = p.Entries
+	}
+
+	var tables int
+	for _, cf := range e.cfs {
+		tables += len(cf.sstables)
+	}
+	e.log.Info("caught up",
+		"dir", e.cfg.DataDir,
+		"records", replayed,
+		"max_seq", maxSeq,
+		"tables", tables,
+		"duration", time.Since(start))
+	return nil
+}
+
+// lists the column family's tables, oldest first.
+func (cf *ColumnFamily) listTables() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(cf.dir, "sst_*.sst"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// opens and pins the column family's current tables, keeping handles of
+// tables already pinned. A table the writer removes while they are being
+// listed restarts the listing.
+func (cf *ColumnFamily) pinTables() error {
+	known := make(map[string]*tableInfo)
+	for _, t := range cf.sstables {
+		known[t.path] = t
+	}
+
+retry:
+	paths, err := cf.listTables()
+	if err != nil {
+		return err
+	}
+
+	var tables []*tableInfo
+	opened := make(map[string]bool)
+	for _, path := range paths {
+		if t, ok := known[path]; ok {
+			tables = append(tables, t)
+			continue
+		}
+
+		st, err := sstable.OpenWithOptions(path, cf.readOptions())
+		if os.IsNotExist(err) {
+			for _, t := range tables {
+				if opened[t.path] {
+					t.pinned.Close()
+				}
+			}
+			goto retry
+		}
+		if err != nil {
+			return err
+		}
+
+		opened[path] = true
+		t := newTableInfo(path, st)
+		t.pinned = st
+		tables = append(tables, t)
+	}
+
+	// tables left behind by a compaction of the writer are not read
+	tables, stale := sortTables(tables)
+	for _, t := range stale {
+		if opened[t.path] {
+			t.pinned.Close()
+		}
+	}
+
+	// close tables that are gone
+	current := make(map[string]bool)
+	for _, t := range tables {
+		current[t.path] = true
+	}
+	for _, t := range cf.sstables {
+		if !current[t.path] {
+			t.unpin()
+		}
+	}
+
+	cf.sstables = tables
+	return nil
+}
+
+// closes the handles kept by a read-only engine.
+func (cf *ColumnFamily) unpinTables() {
+	for _, t := range cf.sstables {
+		t.unpin()
+	}
+}
+
+// drops the pinned handle of a table, closing it unless a prefix scan
+// still reads it. Caller must hold e.mu.
+func (t *tableInfo) unpin() {
+	if t.pinned == nil {
+		return
+	}
+	if t.readers == 0 {
+		t.pinned.Close()
+	}
+	t.pinned = nil
+}
+
+// describes the table st opened from path.
+func newTableInfo(path string, st *sstable.SSTable) *tableInfo {
+	return &tableInfo{
+		path:    path,
+		filter:  st.PrefixFilter(),
+		dels:    st.RangeTombstones(),
+		size:    st.Size(),
+		entries: st.Len(),
+		minSeq:  st.MinSeq(),
+		maxSeq:  st.MaxSeq(),
+	}
+}
+
+// orders tables oldest first, setting apart the stale ones: inputs of an
+// interrupted compaction, whose sequence range its output contains.
+// Of two tables with the same range the later written one is kept.
+// Tables written before their min-seq was recorded (MinSeq 0) have no
+// known range, so they are never stale and never make another one stale.
+func sortTables(tables []*tableInfo) (live, stale []*tableInfo) {
+	for _, t := range tables {
+		contained := false
+		for _, u := range tables {
+			if u == t || t.minSeq == 0 || u.minSeq == 0 {
+				continue
+			}
+			if u.minSeq > t.minSeq || u.maxSeq < t.maxSeq {
+				continue
+			}
+			if u.minSeq < t.minSeq || u.maxSeq > t.maxSeq || u.path > t.path {
+				contained = true
+				break
+			}
+		}
+		if contained {
+			stale = append(stale, t)
+		} else {
+			live = append(live, t)
+		}
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].maxSeq < live[j].maxSeq
+	})
+	return live, stale
+}
+
+// loads the column family's tables at Open, deleting the files a previous
+// run left behind: temporary files of unfinished table writes and the
+// inputs of an interrupted compaction.
+func (cf *ColumnFamily) loadTables() error {
+	tmps, err := filepath.Glob(filepath.Join(cf.dir, "sst_*.sst.tmp"))
+	if err != nil {
+		return err
+	}
+	for _, path := range tmps {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	paths, err := cf.listTables()
+	if err != nil {
+		return err
+	}
+
+	var tables []*tableInfo
+	for _, path := range paths {
+		st, err := sstable.OpenWithOptions(path, cf.readOptions())
+		if err != nil {
+			return err
+		}
+		tables = append(tables, newTableInfo(path, st))
+		st.Close()
+	}
+
+	tables, stale := sortTables(tables)
+	for _, t := range stale {
+		if err := os.Remove(t.path); err != nil {
+			return err
+		}
+		cf.tableDeleted(t.path)
+	}
+
+	cf.sstables = tables
+	return nil
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"fmt"
+
+	"vern_kv/sstable"
+)
+
+// SingleDelete deletes a key that was written exactly once.
+//
+// Unlike Delete, its tombstone vanishes as soon as it meets the value it
+// deletes, in the memtable or during Compact. Deleting a key written more
+// than once is undefined; with Config.Debug set the misuse is reported as
+// ErrSingleDeleteMisuse (the delete is still applied).
+func (e *Engine) SingleDelete(key []byte) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkEntry(key, nil); err != nil {
+		return err
+	}
+
+	e.seq++
+	if err := e.wal.AppendSingleDelete(e.seq, key); err != nil {
+		e.seq--
+		return err
+	}
+
+	misuse, err := e.def.singleDelete(key, e.seq)
+	e.recordWrite(key, nil)
+	if err != nil {
+		return err
+	}
+	e.maybeFlush(e.def)
+	if misuse && e.cfg.Debug {
+		return fmt.Errorf("%w: key %q", ErrSingleDeleteMisuse, key)
+	}
+	return nil
+}
+
+// applies a SingleDelete of key to the active memtable, keeping its
+// tombstone when the key may have versions below that memtable. In debug
+// mode those versions are read, so that misuse spanning them is reported.
+// Caller must hold e.mu.
+func (cf *ColumnFamily) singleDelete(key []byte, seq uint64) (misuse bool, err error) {
+	if !cf.debug {
+		return cf.active.SingleDeleteOlder(key, seq, cf.mayHaveOlder(key)), nil
+	}
+
+	versions := []sstable.Entry{{Key: key, Tombstone: true, SingleDelete: true}}
+	if me, ok := cf.active.Get(key); ok {
+		versions = append(versions, memtableToSSTable(me))
+	}
+	older, err := cf.olderVersions(key)
+	if err != nil {
+		return false, err
+	}
+
+	misuse = cf.active.SingleDeleteOlder(key, seq, len(older) > 0)
+	if checkSingleDelete(append(versions, older...)) != nil {
+		misuse = true
+	}
+	return misuse, nil
+}
+
+// reports whether key may have versions below the active memtable.
+// Caller must hold e.mu.
+func (cf *ColumnFamily) mayHaveOlder(key []byte) bool {
+	for _, mt := range cf.frozen {
+		if _, ok := mt.Get(key); ok {
+			return true
+		}
+	}
+	for _, t := range cf.sstables {
+		if cf.tableMayContainKey(t, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the versions of key below the active memtable (newest first),
+// up to the first tombstone. Caller must hold e.mu.
+func (cf *ColumnFamily) olderVersions(key []byte) ([]sstable.Entry, error) {
+	var versions []sstable.Entry
+	for i := len(cf.frozen) - 1; i >= 0; i-- {
+		if me, ok := cf.frozen[i].Get(key); ok {
+			versions = append(versions, memtableToSSTable(me))
+			if me.Tombstone {
+				return versions, nil
+			}
+		}
+	}
+
+	for i := len(cf.sstables) - 1; i >= 0; i-- {
+		t := cf.sstables[i]
+		if !cf.tableMayContainKey(t, key) {
+			continue
+		}
+
+		st, err := cf.openTable(t)
+		if err != nil {
+			return nil, err
+		}
+		entry, ok, err := st.Get(key)
+		cf.closeTable(t, st)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			versions = append(versions, entry)
+			if entry.Tombstone {
+				break
+			}
+		}
+	}
+	return versions, nil
+}
+
+// reports a SingleDelete (newest first versions) followed by more than one
+// value before any other tombstone.
+func checkSingleDelete(versions []sstable.Entry) error {
+	if !versions[0].SingleDelete {
+		return nil
+	}
+
+	values := 0
+	for _, v := range versions[1:] {
+		if v.Tombstone {
+			break
+		}
+		if !v.Merge {
+			values++
+		}
+	}
+
+	if values > 1 {
+		return fmt.Errorf("%w: key %q", ErrSingleDeleteMisuse, versions[0].Key)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package engine
+
+import "time"
+
+// PutWithTTL writes a value that expires ttl from now, per Config.Clock.
+//
+// Expired keys are invisible to Get and ScanPrefix. Flushes replace an
+// expired value by a tombstone and Compact drops it entirely.
+func (e *Engine) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidTTL
+	}
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if err := e.checkEntry(key, value); err != nil {
+		return err
+	}
+
+	expiresAt := e.cfg.Now().Add(ttl).UnixNano()
+
+	e.seq++
+	if err := e.wal.AppendPutTTL(e.seq, key, value, expiresAt); err != nil {
+		e.seq--
+		return err
+	}
+
+	e.def.active.PutWithExpiry(key, value, e.seq, expiresAt)
+	e.recordWrite(key, value)
+	e.maybeFlush(e.def)
+	return nil
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"sort"
+
+	"vern_kv/wal"
+)
+
+// TwoPhaseTxn is a named transaction for XA-style two-phase commit.
+//
+// Prepare durably logs the buffered writes under the transaction name
+// without making them visible. The prepared transaction is then finished
+// by Commit or Rollback, here or, after a restart, through
+// Engine.CommitPrepared / Engine.RollbackPrepared.
+type TwoPhaseTxn struct {
+	eng  *Engine
+	name string
+
+	writes   []wal.Entry
+	prepared bool
+	done     bool
+}
+
+// BeginTwoPhase starts a two-phase transaction with a coordinator-chosen name.
+func (e *Engine) BeginTwoPhase(name string) *TwoPhaseTxn {
+	return &TwoPhaseTxn{eng: e, name: name}
+}
+
+// Name returns the transaction name.
+func (t *TwoPhaseTxn) Name() string {
+	return t.name
+}
+
+// Put buffers a PUT. key and value are copied.
+func (t *TwoPhaseTxn) Put(key, value []byte) error {
+	return t.buffer(wal.Entry{
+		Key:   append([]byte(nil), key...),
+		Value: append([]byte(nil), value...),
+	})
+}
+
+// Delete buffers a DELETE. key is copied.
+func (t *TwoPhaseTxn) Delete(key []byte) error {
+	return t.buffer(wal.Entry{
+		Key:       append([]byte(nil), key...),
+		Tombstone: true,
+	})
+}
+
+func (t *TwoPhaseTxn) buffer(w wal.Entry) error {
+	if t.done || t.prepared {
+		return ErrTxnDone
+	}
+	t.writes = append(t.writes, w)
+	return nil
+}
+
+// Prepare writes a durable PREPARE record. The writes stay invisible.
+func (t *TwoPhaseTxn) Prepare() error {
+	if t.done || t.prepared {
+		return ErrTxnDone
+	}
+
+	e := t.eng
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if _, ok := e.prepared[t.name]; ok {
+		return ErrTxnExists
+	}
+	for _, op := range t.writes {
+		if err := e.checkBatchEntry(op); err != nil {
+			return err
+		}
+	}
+	if err := e.wal.AppendPrepare(t.name, t.writes); err != nil {
+		return err
+	}
+
+	e.prepared[t.name] = t.writes
+	t.prepared = true
+	return nil
+}
+
+// Commit commits the prepared transaction.
+func (t *TwoPhaseTxn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if !t.prepared {
+		return ErrNotPrepared
+	}
+
+	if err := t.eng.CommitPrepared(t.name); err != nil {
+		return err
+	}
+	t.done = true
+	return nil
+}
+
+// Rollback discards the transaction, logging a ROLLBACK if it was prepared.
+func (t *TwoPhaseTxn) Rollback() error {
+	if t.done {
+		return ErrTxnDone
+	}
+
+	if t.prepared {
+		if err := t.eng.RollbackPrepared(t.name); err != nil {
+			return err
+		}
+	}
+	t.done = true
+	t.writes = nil
+	return nil
+}
+
+// CommitPrepared logs a COMMIT for the named prepared transaction and
+// applies its writes atomically.
+func (e *Engine) CommitPrepared(name string) error {
+	if err := e.throttle(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+
+	entries, ok := e.prepared[name]
+	if !ok {
+		return ErrUnknownTxn
+	}
+	if err := e.wal.AppendCommitPrepared(e.seq+1, name); err != nil {
+		return err
+	}
+
+	delete(e.prepared, name)
+	e.applyBatch(entries)
+	return nil
+}
+
+// RollbackPrepared logs a ROLLBACK for the named prepared transaction.
+func (e *Engine) RollbackPrepared(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.checkWritable(); err != nil {
+		return err
+	}
+	if _, ok := e.prepared[name]; !ok {
+		return ErrUnknownTxn
+	}
+	if err := e.wal.AppendRollbackPrepared(name); err != nil {
+		return err
+	}
+
+	delete(e.prepared, name)
+	return nil
+}
+
+// PreparedTxns returns the names of prepared, undecided transactions, sorted.
+// After Open these are the transactions recovered from the WAL.
+func (e *Engine) PreparedTxns() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.prepared))
+	for name := range e.prepared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
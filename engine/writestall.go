@@ -0,0 +1,261 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/stats"
+)
+
+// WriteOptions configures a single write.
+type WriteOptions struct {
+	// fail with ErrWouldStall instead of being delayed or stopped by
+	// Config.WriteStall
+	NoSlowdown bool
+}
+
+// PutWithOptions is Put with options.
+func (e *Engine) PutWithOptions(key, value []byte, opts WriteOptions) error {
+	defer e.timeOp(stats.PutLatency)()
+
+	if err := e.stallWait(context.Background(), opts); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.put(key, value)
+}
+
+// WriteWithOptions is Write with options.
+func (e *Engine) WriteWithOptions(b *Batch, opts WriteOptions) error {
+	if err := e.stallWait(context.Background(), opts); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.writeBatchOf(b)
+}
+
+// throttles a write without options; see stallWait.
+func (e *Engine) throttle() error {
+	return e.stallWait(context.Background(), WriteOptions{})
+}
+
+// applies Config.WriteStall before a write: returns at once below every
+// Slowdown threshold, sleeps past one, and waits for relief past a Stop
+// threshold. Gives up with ctx.Err(), or ErrWouldStall under NoSlowdown.
+// Must be called without e.mu held.
+func (e *Engine) stallWait(ctx context.Context, opts WriteOptions) error {
+	if !e.cfg.WriteStall.Enabled() {
+		return nil
+	}
+
+	start := time.Now()
+	var stalled, stopped bool
+	defer func() {
+		if stalled {
+			e.stats.Add(stats.WriteStallMicros, uint64(time.Since(start).Microseconds()))
+		}
+	}()
+
+	for {
+		if err := e.lockCtx(ctx); err != nil {
+			return err
+		}
+		if err := e.checkWritable(); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+		cond, delay := e.refreshStall()
+		if cond != config.WriteStallNormal {
+			e.relieveStall()
+		}
+		wake := e.stallWake
+		e.mu.Unlock()
+
+		if cond != config.WriteStallNormal && opts.NoSlowdown {
+			return ErrWouldStall
+		}
+		stalled = stalled || cond != config.WriteStallNormal
+
+		switch cond {
+		case config.WriteStallNormal:
+			return nil
+
+		case config.WriteStallDelayed:
+			e.stats.Add(stats.WriteStallDelays, 1)
+			return sleepCtx(ctx, delay)
+
+		default:
+			if !stopped {
+				stopped = true
+				e.stats.Add(stats.WriteStallStops, 1)
+			}
+
+			// woken by relief, or re-checked after the longest delay
+			timer := time.NewTimer(e.cfg.WriteStall.MaxDelayOrDefault())
+			select {
+			case <-wake:
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+			timer.Stop()
+		}
+	}
+}
+
+// sleeps for d unless ctx ends first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recomputes the stall condition of every column family, reporting the
+// changes, and wakes the stopped writers once nothing is stopped. Returns the
+// worst condition and the delay it asks for. Caller must hold e.mu.
+func (e *Engine) refreshStall() (config.WriteStallCondition, time.Duration) {
+	worst, delay := config.WriteStallNormal, time.Duration(0)
+	for _, cf := range e.cfs {
+		cond, d := cf.stallCondition(e.cfg.WriteStall)
+		if cond != cf.stall {
+			e.log.Warn("write stall", "cf", cf.name, "prev", cf.stall.String(), "cur", cond.String())
+			e.events.writeStall(config.WriteStallInfo{ColumnFamily: cf.name, Prev: cf.stall, Cur: cond})
+			cf.stall = cond
+		}
+		worst = max(worst, cond)
+		delay = max(delay, d)
+	}
+
+	if worst == config.WriteStallStopped {
+		e.stallStopped = true
+	} else if e.stallStopped {
+		e.stallStopped = false
+		e.wakeStalled()
+	}
+	return worst, delay
+}
+
+// wakes the writers waiting at a stop threshold. Caller must hold e.mu.
+func (e *Engine) wakeStalled() {
+	if e.stallWake == nil {
+		return
+	}
+	close(e.stallWake)
+	e.stallWake = make(chan struct{})
+}
+
+// rechecks the stall conditions after work that may relieve them.
+// Caller must hold e.mu.
+func (e *Engine) stallRelief() {
+	if e.cfg.WriteStall.Enabled() {
+		e.refreshStall()
+	}
+}
+
+// starts, at most once at a time per column family, background work
+// relieving the column families past a threshold: their frozen memtables
+// are written, then their tables compacted. A failure is counted like that
+// of Flush(false), and the next throttled write tries again.
+// Caller must hold e.mu, and the engine must be writable.
+func (e *Engine) relieveStall() {
+	for _, cf := range e.cfs {
+		if cf.stall == config.WriteStallNormal || cf.relieving {
+			continue
+		}
+		if len(cf.frozen) == 0 && len(cf.sstables) < 2 {
+			continue // nothing left to relieve, e.g. Slowdown thresholds of 1
+		}
+
+		cf.relieving = true
+		e.bg.Add(1)
+		go func() {
+			defer e.bg.Done()
+
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			defer func() { cf.relieving = false }()
+
+			if err := e.relieve(cf); err != nil && !errors.Is(err, ErrClosed) {
+				e.backgroundFailed("write stall relief failed", err)
+			}
+		}()
+	}
+}
+
+// writes the frozen memtables of cf, then compacts its tables if there
+// are several. Caller must hold e.mu; see flush and compact.
+func (e *Engine) relieve(cf *ColumnFamily) error {
+	if len(cf.frozen) > 0 {
+		if err := e.flushFrozen(cf); err != nil {
+			return err
+		}
+	}
+	if e.closed || cf.dropped || len(cf.sstables) < 2 {
+		return nil
+	}
+
+	if err := e.compact(cf); err != nil {
+		return err
+	}
+	e.stats.Add(stats.Compactions, 1)
+	return nil
+}
+
+// returns the stall condition of the column family under o, and the
+// delay of a delayed write.
+func (cf *ColumnFamily) stallCondition(o config.WriteStallOptions) (config.WriteStallCondition, time.Duration) {
+	frozen := len(cf.frozen)
+	var pending int64
+	if len(cf.sstables) > 1 {
+		for _, t := range cf.sstables {
+			pending += t.size
+		}
+	}
+
+	// fraction of the way from the slowdown to the stop threshold
+	var frac float64
+	check := func(v, slowdown, stop int64) bool {
+		if stop > 0 && v >= stop {
+			return true
+		}
+		if slowdown > 0 && v >= slowdown {
+			f := 1.0
+			if stop > slowdown {
+				f = float64(v-slowdown+1) / float64(stop-slowdown+1)
+			}
+			frac = max(frac, f)
+		}
+		return false
+	}
+
+	// a compaction leaves one table, which must not stop writes for good
+	stopL0 := o.StopL0Tables
+	if stopL0 == 1 {
+		stopL0 = 2
+	}
+
+	if check(int64(frozen), int64(o.SlowdownImmutableMemtables), int64(o.StopImmutableMemtables)) ||
+		check(int64(len(cf.sstables)), int64(o.SlowdownL0Tables), int64(stopL0)) ||
+		check(pending, o.SlowdownPendingBytes, o.StopPendingBytes) {
+		return config.WriteStallStopped, 0
+	}
+	if frac > 0 {
+		return config.WriteStallDelayed, time.Duration(frac * float64(o.MaxDelayOrDefault()))
+	}
+	return config.WriteStallNormal, 0
+}
@@ -0,0 +1,51 @@
+// Package errs defines the errors shared by the storage packages.
+// The engine package re-exports them.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCorruption matches every *CorruptionError.
+	ErrCorruption = errors.New("corruption")
+
+	// ErrKeyTooLarge is returned for keys longer than the configured limit.
+	ErrKeyTooLarge = errors.New("key too large")
+
+	// ErrValueTooLarge is returned for values longer than the configured limit.
+	ErrValueTooLarge = errors.New("value too large")
+)
+
+// CheckSize returns ErrKeyTooLarge or ErrValueTooLarge when key or value
+// exceeds its limit (a limit <= 0 means no limit).
+func CheckSize(key, value []byte, maxKey, maxValue int) error {
+	if maxKey > 0 && len(key) > maxKey {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrKeyTooLarge, len(key), maxKey)
+	}
+	if maxValue > 0 && len(value) > maxValue {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrValueTooLarge, len(value), maxValue)
+	}
+	return nil
+}
+
+// CorruptionError reports damaged on-disk data.
+type CorruptionError struct {
+	File   string
+	Offset int64 // byte offset of the damaged record or block
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corruption in %s at offset %d: %s", e.File, e.Offset, e.Reason)
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorruption
+}
+
+// Corruption returns a *CorruptionError.
+func Corruption(file string, offset int64, reason string) error {
+	return &CorruptionError{File: file, Offset: offset, Reason: reason}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"math/rand"
 	"time"
+	"vern_kv/config"
 	"vern_kv/sstable"
 )
 
@@ -13,17 +14,40 @@ const (
 )
 
 // Entry represents a single key-version.
+// A Merge entry holds operands (oldest first) whose base value lives in an
+// older table; operands on top of a memtable value are folded on insert.
 type Entry struct {
 	Key       []byte
 	Value     []byte
 	Seq       uint64
 	Tombstone bool
+	Merge     bool
+	Operands  [][]byte
+	ExpiresAt int64 // unix nanoseconds, 0 = never
+
+	// a tombstone for a key written exactly once (Tombstone is also set)
+	SingleDelete bool
+}
+
+// reports whether e is a plain value (not a tombstone or merge operand).
+func (e Entry) isValue() bool {
+	return !e.Tombstone && !e.Merge
+}
+
+// returns the bytes accounted for an entry.
+func (e Entry) size() int64 {
+	n := int64(len(e.Key) + len(e.Value))
+	for _, op := range e.Operands {
+		n += int64(len(op))
+	}
+	return n
 }
 
 // node is a SkipList node.
 type node struct {
 	entry   Entry
 	forward []*node
+	puts    int // values written under this key, for SingleDelete checks
 }
 
 // Memtable is a SkipList-backed in-memory table.
@@ -31,20 +55,66 @@ type Memtable struct {
 	head  *node
 	level int
 	size  int64
+	count int
+
+	extract func([]byte) []byte
+	filter  *sstable.PrefixFilter
+
+	merge config.MergeOperator
+	now   func() time.Time
+	cmp   config.Comparator
+
+	// range tombstones, kept beside the skiplist
+	dels []sstable.RangeTombstone
+}
+
+// Options configures a Memtable.
+type Options struct {
+	// tracks key prefixes for prefix filtering when set
+	PrefixExtractor func(key []byte) []byte
+
+	// folds merge operands on insert; required before calling Merge
+	MergeOperator config.MergeOperator
+
+	// decides whether a value folded by a merge has expired (nil = time.Now)
+	Clock func() time.Time
+
+	// key order (nil = config.BytewiseComparator)
+	Comparator config.Comparator
 }
 
 // creates an empty(new) Memtable.
 func New() *Memtable {
+	return NewWithOptions(Options{})
+}
+
+// creates an empty Memtable with options.
+func NewWithOptions(opts Options) *Memtable {
 	rand.Seed(time.Now().UnixNano())
 
 	head := &node{
 		forward: make([]*node, maxLevel),
 	}
 
-	return &Memtable{
-		head:  head,
-		level: 1,
+	m := &Memtable{
+		head:    head,
+		level:   1,
+		extract: opts.PrefixExtractor,
+		merge:   opts.MergeOperator,
+		now:     opts.Clock,
+		cmp:     opts.Comparator,
+	}
+	if m.now == nil {
+		m.now = time.Now
+	}
+	if m.cmp == nil {
+		m.cmp = config.BytewiseComparator
 	}
+	if m.extract != nil {
+		m.filter = sstable.NewPrefixFilter()
+	}
+
+	return m
 }
 
 // returns current size in bytes.
@@ -71,6 +141,16 @@ func (m *Memtable) Put(key, value []byte, seq uint64) {
 	})
 }
 
+// PutWithExpiry inserts key with a value that expires at expiresAt (unix nanoseconds).
+func (m *Memtable) PutWithExpiry(key, value []byte, seq uint64, expiresAt int64) {
+	m.insert(Entry{
+		Key:       key,
+		Value:     value,
+		Seq:       seq,
+		ExpiresAt: expiresAt,
+	})
+}
+
 // Delete inserts a tombstone.
 func (m *Memtable) Delete(key []byte, seq uint64) {
 	m.insert(Entry{
@@ -80,26 +160,137 @@ func (m *Memtable) Delete(key []byte, seq uint64) {
 	})
 }
 
-func (m *Memtable) insert(e Entry) {
-	update := make([]*node, maxLevel)
-	x := m.head
+// Merge inserts a merge operand.
+// The memtable must have been created with a MergeOperator.
+func (m *Memtable) Merge(key, operand []byte, seq uint64) {
+	m.insert(Entry{
+		Key:      key,
+		Seq:      seq,
+		Merge:    true,
+		Operands: [][]byte{operand},
+	})
+}
+
+// DeleteRange records a range tombstone deleting every key in [start, end)
+// with a lower sequence.
+func (m *Memtable) DeleteRange(start, end []byte, seq uint64) {
+	m.dels = append(m.dels, sstable.RangeTombstone{Start: start, End: end, Seq: seq})
+	m.size += int64(len(start) + len(end))
+}
+
+// RangeTombstones returns the memtable's range tombstones.
+func (m *Memtable) RangeTombstones() []sstable.RangeTombstone {
+	return m.dels
+}
 
-	// find positions
+// folds a newer merge entry onto the existing version of its key.
+func (m *Memtable) fold(old, e Entry) Entry {
+	if !old.Merge {
+		var base []byte
+		expired := old.ExpiresAt != 0 && m.now().UnixNano() >= old.ExpiresAt
+		if !old.Tombstone && !expired {
+			base = old.Value
+		}
+		return Entry{
+			Key:   e.Key,
+			Value: m.merge.FullMerge(e.Key, base, e.Operands),
+			Seq:   e.Seq,
+		}
+	}
+
+	ops := append(append([][]byte(nil), old.Operands...), e.Operands...)
+	e.Operands = collapse(m.merge, e.Key, ops)
+	return e
+}
+
+// collapse partially merges adjacent operands where the operator allows it.
+func collapse(op config.MergeOperator, key []byte, ops [][]byte) [][]byte {
+	var out [][]byte
+	for _, o := range ops {
+		if n := len(out); n > 0 {
+			if merged, ok := op.PartialMerge(key, out[n-1], o); ok {
+				out[n-1] = merged
+				continue
+			}
+		}
+		out = append(out, o)
+	}
+	return out
+}
+
+// finds the first node with key >= key, recording the last node before it
+// on every level in update.
+func (m *Memtable) seek(key []byte, update []*node) *node {
+	x := m.head
 	for i := m.level - 1; i >= 0; i-- {
 		for x.forward[i] != nil &&
-			bytes.Compare(x.forward[i].entry.Key, e.Key) < 0 {
+			m.cmp.Compare(x.forward[i].entry.Key, key) < 0 {
 			x = x.forward[i]
 		}
 		update[i] = x
 	}
+	return x.forward[0]
+}
+
+// SingleDelete deletes a key that was written exactly once.
+// When the memtable holds that single value, both it and the delete vanish;
+// otherwise a single-delete tombstone is inserted. It reports misuse: the
+// key having been written more than once in this memtable.
+func (m *Memtable) SingleDelete(key []byte, seq uint64) bool {
+	return m.SingleDeleteOlder(key, seq, false)
+}
+
+// SingleDeleteOlder is SingleDelete for a key that may also have versions
+// older than this memtable (older is true). The tombstone is then always
+// inserted, so that those versions stay hidden.
+func (m *Memtable) SingleDeleteOlder(key []byte, seq uint64, older bool) bool {
+	update := make([]*node, maxLevel)
+	x := m.seek(key, update)
+
+	if x == nil || m.cmp.Compare(x.entry.Key, key) != 0 || seq <= x.entry.Seq {
+		m.insert(Entry{Key: key, Seq: seq, Tombstone: true, SingleDelete: true})
+		return false
+	}
+
+	misuse := x.puts > 1
+	if misuse || older || !x.entry.isValue() {
+		m.insert(Entry{Key: key, Seq: seq, Tombstone: true, SingleDelete: true})
+		return misuse
+	}
+
+	// unlink the node
+	for i := 0; i < len(x.forward); i++ {
+		update[i].forward[i] = x.forward[i]
+	}
+	m.size -= x.entry.size()
+	m.count--
+	return false
+}
+
+func (m *Memtable) insert(e Entry) {
+	if m.filter != nil {
+		m.filter.AddKey(e.Key, m.extract)
+	}
+
+	update := make([]*node, maxLevel)
+	x := m.seek(e.Key, update)
 
 	// check existing key
-	x = x.forward[0]
-	if x != nil && bytes.Equal(x.entry.Key, e.Key) {
+	if x != nil && m.cmp.Compare(x.entry.Key, e.Key) == 0 {
 		if e.Seq > x.entry.Seq {
-			m.size -= int64(len(x.entry.Key) + len(x.entry.Value))
+			if e.isValue() {
+				x.puts++
+			}
+			if e.Merge {
+				old := x.entry
+				if sstable.MaxCoveringSeq(m.cmp, m.dels, e.Key) > old.Seq {
+					old = Entry{Key: old.Key, Seq: old.Seq, Tombstone: true}
+				}
+				e = m.fold(old, e)
+			}
+			m.size -= x.entry.size()
 			x.entry = e
-			m.size += int64(len(e.Key) + len(e.Value))
+			m.size += e.size()
 		}
 		return
 	}
@@ -116,13 +307,17 @@ func (m *Memtable) insert(e Entry) {
 		entry:   e,
 		forward: make([]*node, lvl),
 	}
+	if e.isValue() {
+		n.puts = 1
+	}
 
 	for i := 0; i < lvl; i++ {
 		n.forward[i] = update[i].forward[i]
 		update[i].forward[i] = n
 	}
 
-	m.size += int64(len(e.Key) + len(e.Value))
+	m.size += e.size()
+	m.count++
 }
 
 // Get returns the newest entry for a key.
@@ -131,24 +326,68 @@ func (m *Memtable) Get(key []byte) (Entry, bool) {
 
 	for i := m.level - 1; i >= 0; i-- {
 		for x.forward[i] != nil &&
-			bytes.Compare(x.forward[i].entry.Key, key) < 0 {
+			m.cmp.Compare(x.forward[i].entry.Key, key) < 0 {
 			x = x.forward[i]
 		}
 	}
 
 	x = x.forward[0]
-	if x != nil && bytes.Equal(x.entry.Key, key) {
+	if x != nil && m.cmp.Compare(x.entry.Key, key) == 0 {
 		return x.entry, true
 	}
 
 	return Entry{}, false
 }
 
+// MayContainPrefix reports whether a key with prefix can be present.
+// Always true when no prefix extractor is configured.
+func (m *Memtable) MayContainPrefix(prefix []byte) bool {
+	return m.filter.MayContain(prefix)
+}
+
+// ScanPrefix returns all entries whose key starts with prefix, in key order.
+func (m *Memtable) ScanPrefix(prefix []byte) []Entry {
+	if !m.filter.MayContain(prefix) {
+		return nil
+	}
+
+	// Keys sharing a prefix are contiguous only in bytewise order.
+	if m.cmp.Name() != config.BytewiseComparator.Name() {
+		var entries []Entry
+		for x := m.head.forward[0]; x != nil; x = x.forward[0] {
+			if bytes.HasPrefix(x.entry.Key, prefix) {
+				entries = append(entries, x.entry)
+			}
+		}
+		return entries
+	}
+
+	x := m.head
+	for i := m.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil &&
+			bytes.Compare(x.forward[i].entry.Key, prefix) < 0 {
+			x = x.forward[i]
+		}
+	}
+
+	var entries []Entry
+	for x = x.forward[0]; x != nil && bytes.HasPrefix(x.entry.Key, prefix); x = x.forward[0] {
+		entries = append(entries, x.entry)
+	}
+
+	return entries
+}
+
 // returns approximate memory usage.
 func (m *Memtable) ApproximateSize() int64 {
 	return m.approximateSize()
 }
 
+// returns the number of keys, tombstones included.
+func (m *Memtable) Len() int {
+	return m.count
+}
+
 // returns all entries sorted by key.
 func (m *Memtable) AllEntriesSorted() []sstable.Entry {
 	var entries []sstable.Entry
@@ -161,6 +400,11 @@ func (m *Memtable) AllEntriesSorted() []sstable.Entry {
 			Value:     e.Value,
 			Seq:       e.Seq,
 			Tombstone: e.Tombstone,
+			Merge:     e.Merge,
+			Operands:  e.Operands,
+			ExpiresAt: e.ExpiresAt,
+
+			SingleDelete: e.SingleDelete,
 		})
 		x = x.forward[0]
 	}
@@ -0,0 +1,174 @@
+// Package ratelimit throttles disk writes with a token bucket.
+//
+// A nil *RateLimiter is valid and never throttles.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Priority orders the requests competing for the same bucket.
+type Priority int
+
+const (
+	// background I/O: SSTable writes by flushes and compactions
+	Low Priority = iota
+	// foreground I/O: WAL appends
+	High
+)
+
+// longest single wait, so rate changes and high-priority debt are
+// noticed promptly
+const maxWait = 10 * time.Millisecond
+
+// AutoTune lets a RateLimiter adapt its rate to foreground latency.
+type AutoTune struct {
+	// bounds of the rate in bytes per second
+	MinBytesPerSecond int64
+	MaxBytesPerSecond int64
+
+	// the rate is halved while the average latency passed to
+	// ReportLatency exceeds this, and raised by a tenth otherwise
+	TargetLatency time.Duration
+
+	// minimum time between two adjustments (0 means 100ms)
+	Interval time.Duration
+}
+
+// RateLimiter is a token bucket refilled at a fixed rate of bytes per
+// second and holding at most one second of tokens. One limiter may be
+// shared by several engines.
+//
+// Low-priority requests wait for tokens. High-priority requests never
+// wait: they are charged to the bucket, possibly into debt, so that
+// background I/O leaves room for them.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64   // bytes per second
+	tokens float64 // may be negative after high-priority requests
+	last   time.Time
+
+	tune     *AutoTune
+	latency  time.Duration // moving average of reported latencies
+	lastTune time.Time
+}
+
+// creates a limiter allowing bytesPerSecond bytes per second.
+func New(bytesPerSecond int64) *RateLimiter {
+	now := time.Now()
+	return &RateLimiter{
+		rate:     max(bytesPerSecond, 1),
+		last:     now,
+		lastTune: now,
+	}
+}
+
+// creates a limiter starting at tune.MaxBytesPerSecond and tuned by the
+// latencies passed to ReportLatency.
+func NewAutoTuned(tune AutoTune) *RateLimiter {
+	if tune.Interval <= 0 {
+		tune.Interval = 100 * time.Millisecond
+	}
+	tune.MinBytesPerSecond = max(tune.MinBytesPerSecond, 1)
+	tune.MaxBytesPerSecond = max(tune.MaxBytesPerSecond, tune.MinBytesPerSecond)
+
+	r := New(tune.MaxBytesPerSecond)
+	r.tune = &tune
+	return r
+}
+
+// adds the tokens earned since the last refill. Caller must hold r.mu.
+func (r *RateLimiter) refill(now time.Time) {
+	r.tokens += now.Sub(r.last).Seconds() * float64(r.rate)
+	r.tokens = min(r.tokens, float64(r.rate))
+	r.last = now
+}
+
+// Request takes n bytes worth of tokens, waiting for them unless pri is
+// High. Requests larger than the bucket are served in bucket-sized parts.
+func (r *RateLimiter) Request(n int64, pri Priority) {
+	if r == nil || n <= 0 {
+		return
+	}
+
+	if pri == High {
+		r.mu.Lock()
+		r.refill(time.Now())
+		r.tokens -= float64(n)
+		r.mu.Unlock()
+		return
+	}
+
+	for n > 0 {
+		r.mu.Lock()
+		r.refill(time.Now())
+		chunk := min(n, r.rate)
+		if r.tokens >= float64(chunk) {
+			r.tokens -= float64(chunk)
+			n -= chunk
+			r.mu.Unlock()
+			continue
+		}
+		wait := time.Duration((float64(chunk) - r.tokens) / float64(r.rate) * float64(time.Second))
+		r.mu.Unlock()
+
+		time.Sleep(min(wait, maxWait))
+	}
+}
+
+// SetBytesPerSecond changes the rate. With auto-tuning it also becomes
+// the upper bound of the tuned rate.
+func (r *RateLimiter) SetBytesPerSecond(n int64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refill(time.Now())
+	r.rate = max(n, 1)
+	if r.tune != nil {
+		r.tune.MaxBytesPerSecond = r.rate
+		r.tune.MinBytesPerSecond = min(r.tune.MinBytesPerSecond, r.rate)
+	}
+}
+
+// BytesPerSecond returns the current rate (0 for a nil limiter).
+func (r *RateLimiter) BytesPerSecond() int64 {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rate
+}
+
+// ReportLatency feeds the latency of one foreground operation to an
+// auto-tuned limiter; other limiters ignore it.
+func (r *RateLimiter) ReportLatency(d time.Duration) {
+	if r == nil || r.tune == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// exponential moving average, weight 1/8
+	r.latency += (d - r.latency) / 8
+
+	now := time.Now()
+	if now.Sub(r.lastTune) < r.tune.Interval {
+		return
+	}
+	r.lastTune = now
+	r.refill(now)
+
+	if r.latency > r.tune.TargetLatency {
+		r.rate = max(r.rate/2, r.tune.MinBytesPerSecond)
+	} else {
+		r.rate = min(r.rate+max(r.rate/10, 1), r.tune.MaxBytesPerSecond)
+	}
+}
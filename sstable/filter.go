@@ -0,0 +1,141 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// PrefixFilter records the distinct key prefixes stored in a table.
+// A nil filter matches everything.
+type PrefixFilter struct {
+	prefixes [][]byte // sorted, unique
+}
+
+// creates an empty PrefixFilter.
+func NewPrefixFilter() *PrefixFilter {
+	return &PrefixFilter{}
+}
+
+// BuildPrefixFilter extracts the prefix of every entry key.
+func BuildPrefixFilter(entries []Entry, extract func([]byte) []byte) *PrefixFilter {
+	f := NewPrefixFilter()
+	for _, e := range entries {
+		f.AddKey(e.Key, extract)
+	}
+	return f
+}
+
+// AddKey records the prefix of key.
+// An extractor that does not return a prefix of key falls back to the key itself.
+func (f *PrefixFilter) AddKey(key []byte, extract func([]byte) []byte) {
+	p := extract(key)
+	if !bytes.HasPrefix(key, p) {
+		p = key
+	}
+	f.Add(p)
+}
+
+// Add records a prefix.
+func (f *PrefixFilter) Add(prefix []byte) {
+	i := sort.Search(len(f.prefixes), func(i int) bool {
+		return bytes.Compare(f.prefixes[i], prefix) >= 0
+	})
+	if i < len(f.prefixes) && bytes.Equal(f.prefixes[i], prefix) {
+		return
+	}
+
+	p := append([]byte(nil), prefix...)
+	f.prefixes = append(f.prefixes, nil)
+	copy(f.prefixes[i+1:], f.prefixes[i:])
+	f.prefixes[i] = p
+}
+
+// Len returns the number of distinct prefixes.
+func (f *PrefixFilter) Len() int {
+	if f == nil {
+		return 0
+	}
+	return len(f.prefixes)
+}
+
+// MayContain reports whether a key starting with prefix can be present.
+//
+// Every stored prefix X and any key k with prefix p are both prefixes of k,
+// so a match requires either X to start with p or p to start with X.
+func (f *PrefixFilter) MayContain(prefix []byte) bool {
+	if f == nil {
+		return true
+	}
+
+	// some X starts with prefix
+	i := sort.Search(len(f.prefixes), func(i int) bool {
+		return bytes.Compare(f.prefixes[i], prefix) >= 0
+	})
+	if i < len(f.prefixes) && bytes.HasPrefix(f.prefixes[i], prefix) {
+		return true
+	}
+
+	// some X is a prefix of prefix
+	for n := 0; n < len(prefix); n++ {
+		if f.contains(prefix[:n]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *PrefixFilter) contains(p []byte) bool {
+	i := sort.Search(len(f.prefixes), func(i int) bool {
+		return bytes.Compare(f.prefixes[i], p) >= 0
+	})
+	return i < len(f.prefixes) && bytes.Equal(f.prefixes[i], p)
+}
+
+func (f *PrefixFilter) encode() []byte {
+	size := 4
+	for _, p := range f.prefixes {
+		size += 4 + len(p)
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, uint32(len(f.prefixes)))
+	off := 4
+
+	for _, p := range f.prefixes {
+		binary.BigEndian.PutUint32(buf[off:], uint32(len(p)))
+		off += 4
+		copy(buf[off:], p)
+		off += len(p)
+	}
+
+	return buf
+}
+
+func decodePrefixFilter(buf []byte) (*PrefixFilter, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("invalid prefix filter block")
+	}
+
+	count := binary.BigEndian.Uint32(buf)
+	off := 4
+
+	f := NewPrefixFilter()
+	for i := uint32(0); i < count; i++ {
+		if len(buf)-off < 4 {
+			return nil, fmt.Errorf("invalid prefix filter block")
+		}
+		n := int(binary.BigEndian.Uint32(buf[off:]))
+		off += 4
+
+		if len(buf)-off < n {
+			return nil, fmt.Errorf("invalid prefix filter block")
+		}
+		f.prefixes = append(f.prefixes, append([]byte(nil), buf[off:off+n]...))
+		off += n
+	}
+
+	return f, nil
+}
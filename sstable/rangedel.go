@@ -0,0 +1,108 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"vern_kv/config"
+)
+
+// RangeTombstone deletes every key in [Start, End) with a lower sequence.
+type RangeTombstone struct {
+	Start []byte
+	End   []byte
+	Seq   uint64
+}
+
+// Covers reports whether the tombstone deletes key at seq.
+func (t RangeTombstone) Covers(cmp config.Comparator, key []byte, seq uint64) bool {
+	return seq < t.Seq &&
+		cmp.Compare(t.Start, key) <= 0 &&
+		cmp.Compare(key, t.End) < 0
+}
+
+// MaxCoveringSeq returns the highest sequence of a tombstone whose range
+// contains key (0 if none).
+func MaxCoveringSeq(cmp config.Comparator, tombstones []RangeTombstone, key []byte) uint64 {
+	var max uint64
+	for _, t := range tombstones {
+		if t.Seq > max && t.Covers(cmp, key, t.Seq-1) {
+			max = t.Seq
+		}
+	}
+	return max
+}
+
+// encodes tombstones as: count, then (seq, startLen, start, endLen, end).
+func encodeRangeTombstones(ts []RangeTombstone) []byte {
+	size := 4
+	for _, t := range ts {
+		size += 8 + 4 + len(t.Start) + 4 + len(t.End)
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, uint32(len(ts)))
+	off := 4
+
+	for _, t := range ts {
+		binary.BigEndian.PutUint64(buf[off:], t.Seq)
+		off += 8
+
+		binary.BigEndian.PutUint32(buf[off:], uint32(len(t.Start)))
+		off += 4
+		copy(buf[off:], t.Start)
+		off += len(t.Start)
+
+		binary.BigEndian.PutUint32(buf[off:], uint32(len(t.End)))
+		off += 4
+		copy(buf[off:], t.End)
+		off += len(t.End)
+	}
+
+	return buf
+}
+
+func decodeRangeTombstones(buf []byte) ([]RangeTombstone, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("invalid range tombstone block")
+	}
+
+	count := binary.BigEndian.Uint32(buf)
+	off := 4
+
+	readBytes := func() ([]byte, error) {
+		if len(buf)-off < 4 {
+			return nil, fmt.Errorf("invalid range tombstone block")
+		}
+		n := int(binary.BigEndian.Uint32(buf[off:]))
+		off += 4
+		if len(buf)-off < n {
+			return nil, fmt.Errorf("invalid range tombstone block")
+		}
+		b := append([]byte(nil), buf[off:off+n]...)
+		off += n
+		return b, nil
+	}
+
+	var ts []RangeTombstone
+	for i := uint32(0); i < count; i++ {
+		if len(buf)-off < 8 {
+			return nil, fmt.Errorf("invalid range tombstone block")
+		}
+		seq := binary.BigEndian.Uint64(buf[off:])
+		off += 8
+
+		start, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		end, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		ts = append(ts, RangeTombstone{Start: start, End: end, Seq: seq})
+	}
+
+	return ts, nil
+}
@@ -1,233 +1,852 @@
 package sstable
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"sort"
+
+	"vern_kv/config"
+	"vern_kv/errs"
+	"vern_kv/ratelimit"
 )
 
 const (
 	magicNumber   = 0x544B5631 // "TKV1"
+	magicNumberV2 = 0x544B5632 // "TKV2" (footer carries a meta block offset)
 	flagTombstone = 0x01
+	flagMerge     = 0x02
+	flagTTL       = 0x04 // value is prefixed by an 8-byte expiry
+	flagSingleDel = 0x08 // tombstone written by SingleDelete
+
+	footerSizeV1 = 8 + 8 + 8 + 4
+	footerSizeV2 = 8 + 8 + 8 + 8 + 4
+)
+
+// meta block names
+const (
+	metaPrefixFilter = "vern.prefix-filter"
+	metaComparator   = "vern.comparator"
+	metaRangeDels    = "vern.range-tombstones"
+	metaMinSeq       = "vern.min-seq"
 )
 
 // Entry is a persisted key entry.
+// A Merge entry carries unresolved merge operands (oldest first) instead of a value.
+// ExpiresAt is the expiry of a value in unix nanoseconds (0 = never).
 type Entry struct {
 	Key       []byte
 	Value     []byte
 	Seq       uint64
 	Tombstone bool
+	Merge     bool
+	Operands  [][]byte
+	ExpiresAt int64
+
+	// a tombstone for a key written exactly once (Tombstone is also set)
+	SingleDelete bool
+}
+
+// Expired reports whether the entry's value has expired at now (unix nanoseconds).
+func (e Entry) Expired(now int64) bool {
+	return e.ExpiresAt != 0 && now >= e.ExpiresAt
 }
 
 // SSTable represents an opened SSTable file.
 type SSTable struct {
-	file   *os.File
-	index  map[string]int64
-	maxSeq uint64
+	file *os.File
+	path string
+	size int64
+
+	// entries lie in [0, dataEnd)
+	dataEnd int64
+	maxKey  int
+	maxVal  int
+	index   []indexEntry // sorted by cmp
+	cmp     config.Comparator
+	minSeq  uint64
+	maxSeq  uint64
+	filter  *PrefixFilter
+	dels    []RangeTombstone
+}
+
+// indexEntry locates one key in the data block.
+type indexEntry struct {
+	key []byte
+	off int64
+}
+
+// WriteOptions controls optional SSTable blocks.
+type WriteOptions struct {
+	// builds a prefix filter block when set
+	PrefixExtractor func(key []byte) []byte
+
+	// order the entries must follow (nil means config.BytewiseComparator);
+	// its name is recorded in the table
+	Comparator config.Comparator
+
+	// range tombstones stored in a dedicated block
+	RangeTombstones []RangeTombstone
+
+	// entries with longer keys or values (or merge operands) are refused
+	// with errs.ErrKeyTooLarge / errs.ErrValueTooLarge (0 = 32-bit format limit)
+	MaxKeySize   int
+	MaxValueSize int
+
+	// throttles the file writes at low priority (nil disables)
+	RateLimiter *ratelimit.RateLimiter
+
+	// sequence range recorded for the table, when MaxSeq is set, instead
+	// of the range of its entries (a compaction records its inputs' range)
+	MinSeq uint64
+	MaxSeq uint64
+}
+
+// returns a size limit, capped by the 32-bit lengths of the format.
+func sizeLimit(n int) int {
+	if n <= 0 || int64(n) > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return n
+}
+
+// refuses an entry that exceeds the size limits.
+func (o WriteOptions) check(e Entry) error {
+	maxKey, maxValue := sizeLimit(o.MaxKeySize), sizeLimit(o.MaxValueSize)
+
+	if err := errs.CheckSize(e.Key, e.Value, maxKey, maxValue); err != nil {
+		return fmt.Errorf("sstable key %q: %w", e.Key, err)
+	}
+	for _, op := range e.Operands {
+		if err := errs.CheckSize(nil, op, 0, maxValue); err != nil {
+			return fmt.Errorf("sstable key %q: %w", e.Key, err)
+		}
+	}
+	return nil
+}
+
+// size of the buffer between the encoder and the file
+const writeBufferSize = 64 << 10
+
+// limitedWriter requests tokens from its limiter before each write.
+type limitedWriter struct {
+	w       io.Writer
+	limiter *ratelimit.RateLimiter
+}
+
+func (lw limitedWriter) Write(p []byte) (int, error) {
+	lw.limiter.Request(int64(len(p)), ratelimit.Low)
+	return lw.w.Write(p)
+}
+
+// ReadOptions controls how an SSTable is opened.
+type ReadOptions struct {
+	// must match the comparator the table was written with
+	// (nil means config.BytewiseComparator)
+	Comparator config.Comparator
+
+	// longer keys or values are reported as corruption instead of being
+	// allocated (0 = 32-bit format limit)
+	MaxKeySize   int
+	MaxValueSize int
+}
+
+// ErrComparatorMismatch is returned by Open when the table was written
+// with a different comparator.
+var ErrComparatorMismatch = errors.New("sstable comparator mismatch")
+
+func comparatorOrDefault(c config.Comparator) config.Comparator {
+	if c != nil {
+		return c
+	}
+	return config.BytewiseComparator
 }
 
 // Write creates a new SSTable at path.
 func Write(path string, entries []Entry) error {
+	return WriteWithOptions(path, entries, WriteOptions{})
+}
+
+// WriteWithOptions creates a new SSTable at path with optional blocks.
+// entries must be strictly increasing under opts.Comparator.
+func WriteWithOptions(path string, entries []Entry, opts WriteOptions) error {
+	cmp := comparatorOrDefault(opts.Comparator)
+	for i := 1; i < len(entries); i++ {
+		if cmp.Compare(entries[i-1].Key, entries[i].Key) >= 0 {
+			return fmt.Errorf("sstable entries out of order at %q", entries[i].Key)
+		}
+	}
+	for _, e := range entries {
+		if err := opts.check(e); err != nil {
+			return err
+		}
+	}
+	for _, t := range opts.RangeTombstones {
+		if err := opts.check(Entry{Key: t.Start, Value: t.End}); err != nil {
+			return err
+		}
+	}
+
 	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	index := make(map[string]int64)
+	// writes are charged to the rate limiter a buffer at a time
+	w := bufio.NewWriterSize(limitedWriter{f, opts.RateLimiter}, writeBufferSize)
+
+	index := make([]indexEntry, 0, len(entries))
 
 	var offset int64
 	for _, e := range entries {
-		index[string(e.Key)] = offset
+		index = append(index, indexEntry{key: e.Key, off: offset})
 
 		var flags byte
+		value := e.Value
 		if e.Tombstone {
 			flags = flagTombstone
+			if e.SingleDelete {
+				flags |= flagSingleDel
+			}
+		}
+		if e.Merge {
+			flags = flagMerge
+			value = EncodeOperands(e.Operands)
+			if int64(len(value)) > math.MaxUint32 {
+				return fmt.Errorf("sstable key %q: %w: merge operands", e.Key, errs.ErrValueTooLarge)
+			}
+		}
+		if flags == 0 && e.ExpiresAt != 0 {
+			flags = flagTTL
+			value = make([]byte, 8+len(e.Value))
+			binary.BigEndian.PutUint64(value, uint64(e.ExpiresAt))
+			copy(value[8:], e.Value)
 		}
 
 		keyLen := uint32(len(e.Key))
-		valLen := uint32(len(e.Value))
+		valLen := uint32(len(value))
 
-		if err := binary.Write(f, binary.BigEndian, keyLen); err != nil {
+		if err := binary.Write(w, binary.BigEndian, keyLen); err != nil {
 			return err
 		}
-		if err := binary.Write(f, binary.BigEndian, valLen); err != nil {
+		if err := binary.Write(w, binary.BigEndian, valLen); err != nil {
 			return err
 		}
-		if err := binary.Write(f, binary.BigEndian, e.Seq); err != nil {
+		if err := binary.Write(w, binary.BigEndian, e.Seq); err != nil {
 			return err
 		}
-		if _, err := f.Write([]byte{flags}); err != nil {
+		if _, err := w.Write([]byte{flags}); err != nil {
 			return err
 		}
-		if _, err := f.Write(e.Key); err != nil {
+		if _, err := w.Write(e.Key); err != nil {
 			return err
 		}
-		if _, err := f.Write(e.Value); err != nil {
+		if _, err := w.Write(value); err != nil {
 			return err
 		}
 
-		offset += int64(4 + 4 + 8 + 1 + len(e.Key) + len(e.Value))
+		offset += int64(4 + 4 + 8 + 1 + len(e.Key) + len(value))
 	}
 
 	indexOffset := offset
 
-	// Write index block
-	for k, off := range index {
-		key := []byte(k)
-		if err := binary.Write(f, binary.BigEndian, uint32(len(key))); err != nil {
+	// Write index block (in key order)
+	for _, ie := range index {
+		if err := binary.Write(w, binary.BigEndian, uint32(len(ie.key))); err != nil {
 			return err
 		}
-		if _, err := f.Write(key); err != nil {
+		if _, err := w.Write(ie.key); err != nil {
 			return err
 		}
-		if err := binary.Write(f, binary.BigEndian, off); err != nil {
+		if err := binary.Write(w, binary.BigEndian, ie.off); err != nil {
 			return err
 		}
-		offset += int64(4 + len(key) + 8)
+		offset += int64(4 + len(ie.key) + 8)
+	}
+
+	minSeq, maxSeq := SeqRange(entries, opts.RangeTombstones)
+	if opts.MaxSeq != 0 {
+		minSeq, maxSeq = opts.MinSeq, opts.MaxSeq
+	}
+
+	// Write meta block
+	meta := map[string][]byte{
+		metaComparator: []byte(cmp.Name()),
+		metaMinSeq:     binary.BigEndian.AppendUint64(nil, minSeq),
+	}
+	if opts.PrefixExtractor != nil {
+		meta[metaPrefixFilter] = BuildPrefixFilter(entries, opts.PrefixExtractor).encode()
+	}
+	if len(opts.RangeTombstones) > 0 {
+		meta[metaRangeDels] = encodeRangeTombstones(opts.RangeTombstones)
+	}
+
+	metaOffset := offset
+	if err := writeMeta(w, meta); err != nil {
+		return err
 	}
 
 	// Write footer
-	if err := binary.Write(f, binary.BigEndian, indexOffset); err != nil {
+	if err := binary.Write(w, binary.BigEndian, indexOffset); err != nil {
 		return err
 	}
-	if err := binary.Write(f, binary.BigEndian, uint64(len(entries))); err != nil {
+	if err := binary.Write(w, binary.BigEndian, uint64(len(entries))); err != nil {
 		return err
 	}
 
-	var maxSeq uint64
-	for _, e := range entries {
-		if e.Seq > maxSeq {
-			maxSeq = e.Seq
-		}
+	if err := binary.Write(w, binary.BigEndian, maxSeq); err != nil {
+		return err
 	}
-	if err := binary.Write(f, binary.BigEndian, maxSeq); err != nil {
+	if err := binary.Write(w, binary.BigEndian, uint64(metaOffset)); err != nil {
 		return err
 	}
-	if err := binary.Write(f, binary.BigEndian, uint32(magicNumber)); err != nil {
+	if err := binary.Write(w, binary.BigEndian, uint32(magicNumberV2)); err != nil {
 		return err
 	}
 
+	if err := w.Flush(); err != nil {
+		return err
+	}
 	return f.Sync()
 }
 
+// SeqRange returns the lowest and highest sequence of entries and range
+// tombstones (0, 0 when there are none).
+func SeqRange(entries []Entry, dels []RangeTombstone) (minSeq, maxSeq uint64) {
+	seqs := make([]uint64, 0, len(entries)+len(dels))
+	for _, e := range entries {
+		seqs = append(seqs, e.Seq)
+	}
+	for _, t := range dels {
+		seqs = append(seqs, t.Seq)
+	}
+
+	for i, seq := range seqs {
+		if i == 0 || seq < minSeq {
+			minSeq = seq
+		}
+		if seq > maxSeq {
+			maxSeq = seq
+		}
+	}
+	return minSeq, maxSeq
+}
+
+// writes the meta block: count, then (nameLen, name, dataLen, data) sorted by name.
+func writeMeta(w io.Writer, meta map[string][]byte) error {
+	names := make([]string, 0, len(meta))
+	for name := range meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := binary.Write(w, binary.BigEndian, uint32(len(names))); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		data := meta[name]
+		if err := binary.Write(w, binary.BigEndian, uint32(len(name))); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(name)); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reads a meta block of n bytes. Lengths reaching past the block are
+// reported as io.ErrUnexpectedEOF before anything is allocated.
+func readMeta(r io.Reader, n int64) (map[string][]byte, error) {
+	readLen := func() (uint32, error) {
+		var l uint32
+		if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+			return 0, err
+		}
+		n -= 4
+		if int64(l) > n {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return l, nil
+	}
+	readBytes := func() ([]byte, error) {
+		l, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, l)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		n -= int64(l)
+		return buf, nil
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	n -= 4
+	// every pair takes at least 8 bytes
+	if int64(count) > n/8 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	meta := make(map[string][]byte, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		meta[string(name)] = data
+	}
+
+	return meta, nil
+}
+
 // opens an SSTable for read.
 func Open(path string) (*SSTable, error) {
+	return OpenWithOptions(path, ReadOptions{})
+}
+
+// opens an SSTable for read with an explicit comparator.
+// Tables without a recorded comparator are assumed to be bytewise.
+// Damaged tables are reported as *errs.CorruptionError.
+func OpenWithOptions(path string, opts ReadOptions) (_ *SSTable, err error) {
+	cmp := comparatorOrDefault(opts.Comparator)
+
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
 
-	stat, _ := f.Stat()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
 	size := stat.Size()
 
-	// Read footer
-	if _, err := f.Seek(size-28, io.SeekStart); err != nil {
+	// Read magic (last 4 bytes) to pick the footer layout
+	if size < 4 {
+		return nil, corruption(path, 0, "file too small", nil)
+	}
+	var magic uint32
+	if err := binary.Read(io.NewSectionReader(f, size-4, 4), binary.BigEndian, &magic); err != nil {
 		return nil, err
 	}
 
+	var footerSize int64
+	switch magic {
+	case magicNumber:
+		footerSize = footerSizeV1
+	case magicNumberV2:
+		footerSize = footerSizeV2
+	default:
+		return nil, corruption(path, size-4, "invalid sstable magic", nil)
+	}
+
+	// Read footer
+	if size < footerSize {
+		return nil, corruption(path, 0, "truncated footer", nil)
+	}
+	footer := io.NewSectionReader(f, size-footerSize, footerSize)
+
 	var indexOffset uint64
 	var entryCount uint64
 	var maxSeq uint64
-	var magic uint32
+	var metaOffset uint64
 
-	if err := binary.Read(f, binary.BigEndian, &indexOffset); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(f, binary.BigEndian, &entryCount); err != nil {
-		return nil, err
+	for _, field := range []*uint64{&indexOffset, &entryCount, &maxSeq} {
+		if err := binary.Read(footer, binary.BigEndian, field); err != nil {
+			return nil, corruption(path, size-footerSize, "truncated footer", err)
+		}
 	}
-	if err := binary.Read(f, binary.BigEndian, &maxSeq); err != nil {
-		return nil, err
+	if magic == magicNumberV2 {
+		if err := binary.Read(footer, binary.BigEndian, &metaOffset); err != nil {
+			return nil, corruption(path, size-footerSize, "truncated footer", err)
+		}
 	}
-	if err := binary.Read(f, binary.BigEndian, &magic); err != nil {
-		return nil, err
+
+	// Blocks are laid out as data, index, meta, footer.
+	footerOff := size - footerSize
+	indexOff, indexEnd := int64(indexOffset), footerOff
+	if magic == magicNumberV2 {
+		if metaOffset > uint64(footerOff) || indexOffset > metaOffset {
+			return nil, corruption(path, footerOff, "block offsets out of range", nil)
+		}
+		indexEnd = int64(metaOffset)
+	} else if indexOffset > uint64(footerOff) {
+		return nil, corruption(path, footerOff, "block offsets out of range", nil)
 	}
 
-	if magic != magicNumber {
-		return nil, fmt.Errorf("invalid sstable magic")
+	// Read meta block
+	var filter *PrefixFilter
+	var dels []RangeTombstone
+	var minSeq uint64
+	tableCmp := config.BytewiseComparator.Name()
+	if magic == magicNumberV2 {
+		metaOff := int64(metaOffset)
+		meta, err := readMeta(io.NewSectionReader(f, metaOff, footerOff-metaOff), footerOff-metaOff)
+		if err != nil {
+			return nil, corruption(path, metaOff, "invalid meta block", err)
+		}
+		if data, ok := meta[metaPrefixFilter]; ok {
+			if filter, err = decodePrefixFilter(data); err != nil {
+				return nil, corruption(path, metaOff, err.Error(), nil)
+			}
+		}
+		if name, ok := meta[metaComparator]; ok {
+			tableCmp = string(name)
+		}
+		if data, ok := meta[metaRangeDels]; ok {
+			if dels, err = decodeRangeTombstones(data); err != nil {
+				return nil, corruption(path, metaOff, err.Error(), nil)
+			}
+		}
+		if data, ok := meta[metaMinSeq]; ok {
+			if len(data) != 8 {
+				return nil, corruption(path, metaOff, "invalid min-seq block", nil)
+			}
+			minSeq = binary.BigEndian.Uint64(data)
+		}
 	}
 
-	index := make(map[string]int64)
+	if tableCmp != cmp.Name() {
+		return nil, fmt.Errorf("%w: table %q, want %q", ErrComparatorMismatch, tableCmp, cmp.Name())
+	}
 
-	// Read index block
-	if _, err := f.Seek(int64(indexOffset), io.SeekStart); err != nil {
-		return nil, err
+	// Read index block; every index entry takes at least 12 bytes
+	indexLen := indexEnd - indexOff
+	if entryCount > uint64(indexLen)/12 {
+		return nil, corruption(path, indexOff, "entry count exceeds index block", nil)
 	}
+	index := make([]indexEntry, 0, entryCount)
+	r := io.NewSectionReader(f, indexOff, indexLen)
+	maxKey := sizeLimit(opts.MaxKeySize)
 
 	for i := uint64(0); i < entryCount; i++ {
 		var keyLen uint32
-		if err := binary.Read(f, binary.BigEndian, &keyLen); err != nil {
-			return nil, err
+		if err := binary.Read(r, binary.BigEndian, &keyLen); err != nil {
+			return nil, corruption(path, indexOff, "truncated index block", err)
+		}
+		if int64(keyLen) > int64(maxKey) {
+			return nil, corruption(path, indexOff, fmt.Sprintf("index key length %d exceeds limit %d", keyLen, maxKey), nil)
+		}
+		if pos, _ := r.Seek(0, io.SeekCurrent); int64(keyLen)+8 > indexLen-pos {
+			return nil, corruption(path, indexOff, "truncated index block", nil)
 		}
 
 		key := make([]byte, keyLen)
-		if _, err := io.ReadFull(f, key); err != nil {
-			return nil, err
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, corruption(path, indexOff, "truncated index block", err)
 		}
 
 		var off int64
-		if err := binary.Read(f, binary.BigEndian, &off); err != nil {
-			return nil, err
+		if err := binary.Read(r, binary.BigEndian, &off); err != nil {
+			return nil, corruption(path, indexOff, "truncated index block", err)
+		}
+		if off < 0 || off >= indexOff {
+			return nil, corruption(path, indexOff, fmt.Sprintf("index entry offset %d outside the data block", off), nil)
 		}
 
-		index[string(key)] = off
+		index = append(index, indexEntry{key: key, off: off})
 	}
 
+	// v1 tables wrote their index in arbitrary order
+	sort.SliceStable(index, func(i, j int) bool {
+		return cmp.Compare(index[i].key, index[j].key) < 0
+	})
+
 	return &SSTable{
-		file:   f,
-		index:  index,
-		maxSeq: maxSeq,
+		file:    f,
+		path:    path,
+		size:    size,
+		dataEnd: indexOff,
+		maxKey:  maxKey,
+		maxVal:  sizeLimit(opts.MaxValueSize),
+		index:   index,
+		cmp:     cmp,
+		minSeq:  minSeq,
+		maxSeq:  maxSeq,
+		filter:  filter,
+		dels:    dels,
 	}, nil
 }
 
+// PrefixFilter returns the table's prefix filter (nil if none was written).
+func (s *SSTable) PrefixFilter() *PrefixFilter {
+	return s.filter
+}
+
+// MinSeq returns the lowest sequence number stored in the table
+// (0 for tables written before it was recorded).
+func (s *SSTable) MinSeq() uint64 {
+	return s.minSeq
+}
+
+// Len returns the number of entries in the table.
+func (s *SSTable) Len() int {
+	return len(s.index)
+}
+
+// Size returns the size of the table file in bytes.
+func (s *SSTable) Size() int64 {
+	return s.size
+}
+
+// MaxSeq returns the highest sequence number stored in the table.
+func (s *SSTable) MaxSeq() uint64 {
+	return s.maxSeq
+}
+
+// RangeTombstones returns the table's range tombstones.
+func (s *SSTable) RangeTombstones() []RangeTombstone {
+	return s.dels
+}
+
 // Get returns an entry for a key.
 func (s *SSTable) Get(key []byte) (Entry, bool, error) {
-	off, ok := s.index[string(key)]
-	if !ok {
+	i := sort.Search(len(s.index), func(i int) bool {
+		return s.cmp.Compare(s.index[i].key, key) >= 0
+	})
+	if i == len(s.index) || s.cmp.Compare(s.index[i].key, key) != 0 {
 		return Entry{}, false, nil
 	}
 
-	if _, err := s.file.Seek(off, io.SeekStart); err != nil {
+	e, err := s.readEntry(s.index[i].off)
+	if err != nil {
 		return Entry{}, false, err
 	}
+	return e, true, nil
+}
 
-	var keyLen uint32
-	var valLen uint32
-	var seq uint64
+// ScanPrefix returns all entries whose key starts with prefix,
+// in comparator order.
+func (s *SSTable) ScanPrefix(prefix []byte) ([]Entry, error) {
+	var entries []Entry
+	it := s.NewPrefixIterator(prefix)
+	for {
+		e, ok, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return entries, nil
+		}
+		entries = append(entries, e)
+	}
+}
 
-	if err := binary.Read(s.file, binary.BigEndian, &keyLen); err != nil {
-		return Entry{}, false, err
+// Iterator reads the entries of a table whose key starts with a prefix,
+// in comparator order. Entries are read one Next at a time.
+type Iterator struct {
+	s      *SSTable
+	prefix []byte
+	pos    int // next index entry
+
+	// keys sharing a prefix are contiguous only in bytewise order;
+	// other orders check every key
+	contiguous bool
+}
+
+// NewPrefixIterator returns an iterator over the entries whose key starts
+// with prefix. In bytewise order it starts at the first of them, found by
+// binary search in the index, and stops after the last one.
+func (s *SSTable) NewPrefixIterator(prefix []byte) *Iterator {
+	it := &Iterator{
+		s:          s,
+		prefix:     prefix,
+		contiguous: s.cmp.Name() == config.BytewiseComparator.Name(),
 	}
-	if err := binary.Read(s.file, binary.BigEndian, &valLen); err != nil {
-		return Entry{}, false, err
+
+	switch {
+	case !s.filter.MayContain(prefix):
+		it.pos = len(s.index)
+	case it.contiguous:
+		it.pos = sort.Search(len(s.index), func(i int) bool {
+			return bytes.Compare(s.index[i].key, prefix) >= 0
+		})
 	}
-	if err := binary.Read(s.file, binary.BigEndian, &seq); err != nil {
-		return Entry{}, false, err
+	return it
+}
+
+// Next returns the next entry; ok is false once the prefix is exhausted.
+func (it *Iterator) Next() (e Entry, ok bool, err error) {
+	for it.pos < len(it.s.index) {
+		ie := it.s.index[it.pos]
+		if !bytes.HasPrefix(ie.key, it.prefix) {
+			if it.contiguous {
+				it.pos = len(it.s.index)
+				break
+			}
+			it.pos++
+			continue
+		}
+
+		it.pos++
+		e, err := it.s.readEntry(ie.off)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		return e, true, nil
 	}
+	return Entry{}, false, nil
+}
 
-	flags := make([]byte, 1)
-	if _, err := io.ReadFull(s.file, flags); err != nil {
-		return Entry{}, false, err
+// reads the entry stored at off.
+// Reads go through ReadAt, so concurrent lookups are safe.
+func (s *SSTable) readEntry(off int64) (Entry, error) {
+	r := io.NewSectionReader(s.file, off, math.MaxInt64-off)
+
+	header := make([]byte, 4+4+8+1)
+	if off+int64(len(header)) > s.dataEnd {
+		return Entry{}, s.corrupt(off, "entry runs past the data block", nil)
+	}
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Entry{}, s.corrupt(off, "truncated entry", err)
+	}
+	keyLen := binary.BigEndian.Uint32(header)
+	valLen := binary.BigEndian.Uint32(header[4:])
+	seq := binary.BigEndian.Uint64(header[8:])
+	flags := header[16]
+
+	if int64(keyLen)+int64(valLen) > s.dataEnd-off-int64(len(header)) {
+		return Entry{}, s.corrupt(off, "entry runs past the data block", nil)
+	}
+	if int64(keyLen) > int64(s.maxKey) {
+		return Entry{}, s.corrupt(off, fmt.Sprintf("key length %d exceeds limit %d", keyLen, s.maxKey), nil)
+	}
+	maxVal := int64(s.maxVal)
+	if flags&flagTTL != 0 {
+		maxVal += 8
+	}
+	if flags&flagMerge == 0 && int64(valLen) > maxVal {
+		return Entry{}, s.corrupt(off, fmt.Sprintf("value length %d exceeds limit %d", valLen, maxVal), nil)
 	}
 
 	k := make([]byte, keyLen)
-	if _, err := io.ReadFull(s.file, k); err != nil {
-		return Entry{}, false, err
+	if _, err := io.ReadFull(r, k); err != nil {
+		return Entry{}, s.corrupt(off, "truncated entry", err)
 	}
 
 	v := make([]byte, valLen)
-	if _, err := io.ReadFull(s.file, v); err != nil {
-		return Entry{}, false, err
+	if _, err := io.ReadFull(r, v); err != nil {
+		return Entry{}, s.corrupt(off, "truncated entry", err)
 	}
 
-	return Entry{
+	e := Entry{
 		Key:       k,
 		Value:     v,
 		Seq:       seq,
-		Tombstone: flags[0] == flagTombstone,
-	}, true, nil
+		Tombstone: flags&flagTombstone != 0,
+
+		SingleDelete: flags&flagSingleDel != 0,
+	}
+
+	if flags&flagTTL != 0 {
+		if len(v) < 8 {
+			return Entry{}, s.corrupt(off, "invalid ttl entry", nil)
+		}
+		e.ExpiresAt = int64(binary.BigEndian.Uint64(v))
+		e.Value = v[8:]
+	}
+
+	if flags&flagMerge != 0 {
+		ops, err := DecodeOperands(v)
+		if err != nil {
+			return Entry{}, s.corrupt(off, err.Error(), nil)
+		}
+		e.Value = nil
+		e.Merge = true
+		e.Operands = ops
+	}
+
+	return e, nil
+}
+
+// reports damaged data at off in the table.
+func (s *SSTable) corrupt(off int64, reason string, err error) error {
+	return corruption(s.path, off, reason, err)
+}
+
+// reports a decode failure, or a read that ran off the end of the file,
+// as corruption at off in path. Other I/O errors are returned unchanged.
+func corruption(path string, off int64, reason string, err error) error {
+	if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errs.Corruption(path, off, reason)
+	}
+	return err
+}
+
+// EncodeOperands encodes merge operands as: count, then (len, operand).
+func EncodeOperands(ops [][]byte) []byte {
+	size := 4
+	for _, op := range ops {
+		size += 4 + len(op)
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, uint32(len(ops)))
+	off := 4
+
+	for _, op := range ops {
+		binary.BigEndian.PutUint32(buf[off:], uint32(len(op)))
+		off += 4
+		copy(buf[off:], op)
+		off += len(op)
+	}
+
+	return buf
+}
+
+// DecodeOperands decodes operands written by EncodeOperands.
+func DecodeOperands(buf []byte) ([][]byte, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("invalid merge operands")
+	}
+
+	count := binary.BigEndian.Uint32(buf)
+	off := 4
+
+	var ops [][]byte
+	for i := uint32(0); i < count; i++ {
+		if len(buf)-off < 4 {
+			return nil, fmt.Errorf("invalid merge operands")
+		}
+		n := int(binary.BigEndian.Uint32(buf[off:]))
+		off += 4
+
+		if len(buf)-off < n {
+			return nil, fmt.Errorf("invalid merge operands")
+		}
+		ops = append(ops, buf[off:off+n])
+		off += n
+	}
+
+	return ops, nil
 }
 
 // closes the SSTable.
@@ -0,0 +1,48 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// metric names are prefixed with this namespace
+const namespace = "vern"
+
+// WritePrometheus writes every ticker and histogram in the Prometheus text
+// exposition format. Tickers become counters named vern_<ticker>_total;
+// histograms are in seconds and named vern_<histogram>_seconds.
+func (s *Stats) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	for t := Ticker(0); t < numTickers; t++ {
+		name := fmt.Sprintf("%s_%s_total", namespace, t)
+		fmt.Fprintf(bw, "# TYPE %s counter\n", name)
+		fmt.Fprintf(bw, "%s %d\n", name, s.Ticker(t))
+	}
+
+	for h := Histogram(0); h < numHistograms; h++ {
+		snap := s.Histogram(h)
+		name := fmt.Sprintf("%s_%s_seconds", namespace, h)
+		fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+		for _, b := range snap.Buckets {
+			le := strconv.FormatFloat(b.UpperBound.Seconds(), 'g', -1, 64)
+			fmt.Fprintf(bw, "%s_bucket{le=\"%s\"} %d\n", name, le, b.Count)
+		}
+		fmt.Fprintf(bw, "%s_bucket{le=\"+Inf\"} %d\n", name, snap.Count)
+		fmt.Fprintf(bw, "%s_sum %s\n", name, strconv.FormatFloat(snap.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(bw, "%s_count %d\n", name, snap.Count)
+	}
+
+	return bw.Flush()
+}
+
+// Handler serves WritePrometheus, to be mounted on e.g. /metrics.
+func (s *Stats) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = s.WritePrometheus(w)
+	})
+}
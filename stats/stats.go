@@ -0,0 +1,201 @@
+// Package stats collects engine counters and latency histograms.
+//
+// A nil *Stats is valid and ignores everything, so disabled statistics
+// cost a nil check per event.
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Ticker is a monotonically increasing counter.
+type Ticker int
+
+const (
+	// keys written by puts, deletes, merges and batches
+	KeysWritten Ticker = iota
+	// key and value bytes written
+	BytesWritten
+	// point lookups
+	KeysRead
+	// bytes appended to the WAL
+	WALBytes
+	// fsyncs of the WAL
+	WALSyncs
+	// memtables written to SSTables
+	Flushes
+	// SSTable files opened
+	SSTableOpens
+	// SSTables probed by point lookups; read amplification is
+	// SSTableProbes / KeysRead
+	SSTableProbes
+	// compactions run
+	Compactions
+	// writes delayed, and writes that waited at a stop threshold
+	WriteStallDelays
+	WriteStallStops
+	// microseconds writes spent stalled
+	WriteStallMicros
+
+	numTickers
+)
+
+var tickerNames = [numTickers]string{
+	KeysWritten:   "keys_written",
+	BytesWritten:  "bytes_written",
+	KeysRead:      "keys_read",
+	WALBytes:      "wal_bytes",
+	WALSyncs:      "wal_syncs",
+	Flushes:       "flushes",
+	SSTableOpens:  "sstable_opens",
+	SSTableProbes: "sstable_probes",
+	Compactions:   "compactions",
+
+	WriteStallDelays: "write_stall_delays",
+	WriteStallStops:  "write_stall_stops",
+	WriteStallMicros: "write_stall_micros",
+}
+
+// String returns the metric name of t.
+func (t Ticker) String() string {
+	return tickerNames[t]
+}
+
+// Histogram is a latency distribution.
+type Histogram int
+
+const (
+	PutLatency Histogram = iota
+	GetLatency
+	FlushLatency
+	WALSyncLatency
+
+	numHistograms
+)
+
+var histogramNames = [numHistograms]string{
+	PutLatency:     "put_latency",
+	GetLatency:     "get_latency",
+	FlushLatency:   "flush_latency",
+	WALSyncLatency: "wal_sync_latency",
+}
+
+// String returns the metric name of h.
+func (h Histogram) String() string {
+	return histogramNames[h]
+}
+
+// upper bounds of the histogram buckets; slower events fall in +Inf
+var bucketBounds = []time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type histogram struct {
+	counts [9]atomic.Uint64 // per bucket, the last one is +Inf
+	sum    atomic.Int64     // nanoseconds
+}
+
+// Stats holds the tickers and histograms of one engine.
+type Stats struct {
+	tickers [numTickers]atomic.Uint64
+	hists   [numHistograms]histogram
+}
+
+// creates an empty Stats.
+func New() *Stats {
+	return &Stats{}
+}
+
+// Add increments t by n.
+func (s *Stats) Add(t Ticker, n uint64) {
+	if s == nil {
+		return
+	}
+	s.tickers[t].Add(n)
+}
+
+// Ticker returns the current value of t.
+func (s *Stats) Ticker(t Ticker) uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.tickers[t].Load()
+}
+
+// Start returns the start time of an event timed with Since
+// (the zero time when s is nil, to skip reading the clock).
+func (s *Stats) Start() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// Since records the time elapsed since start in h.
+func (s *Stats) Since(h Histogram, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.Observe(h, time.Since(start))
+}
+
+// Observe records one event of duration d in h.
+func (s *Stats) Observe(h Histogram, d time.Duration) {
+	if s == nil {
+		return
+	}
+	hist := &s.hists[h]
+
+	i := 0
+	for i < len(bucketBounds) && d > bucketBounds[i] {
+		i++
+	}
+	hist.counts[i].Add(1)
+	hist.sum.Add(int64(d))
+}
+
+// Bucket counts the events at most UpperBound long.
+type Bucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// HistogramSnapshot is a copy of a histogram.
+type HistogramSnapshot struct {
+	Count uint64
+	Sum   time.Duration
+
+	// cumulative, in increasing UpperBound order; events slower than the
+	// last bound are only included in Count
+	Buckets []Bucket
+}
+
+// Histogram returns a snapshot of h. Count is the sum of the bucket counts
+// read, so it is never below the last bucket even while events are observed.
+func (s *Stats) Histogram(h Histogram) HistogramSnapshot {
+	snap := HistogramSnapshot{Buckets: make([]Bucket, len(bucketBounds))}
+	if s == nil {
+		for i, bound := range bucketBounds {
+			snap.Buckets[i] = Bucket{UpperBound: bound}
+		}
+		return snap
+	}
+
+	hist := &s.hists[h]
+	var cum uint64
+	for i, bound := range bucketBounds {
+		cum += hist.counts[i].Load()
+		snap.Buckets[i] = Bucket{UpperBound: bound, Count: cum}
+	}
+	snap.Count = cum + hist.counts[len(bucketBounds)].Load()
+	snap.Sum = time.Duration(hist.sum.Load())
+	return snap
+}
@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Column Family Test
+func TestColumnFamilyIsolation(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	meta, err := eng.CreateColumnFamily("meta", config.ColumnFamilyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := eng.CreateColumnFamily("meta", config.ColumnFamilyOptions{}); !errors.Is(err, engine.ErrColumnFamilyExists) {
+		t.Fatalf("expected ErrColumnFamilyExists, got %v", err)
+	}
+
+	_ = eng.Put([]byte("k"), []byte("default"))
+	_ = eng.PutCF(meta, []byte("k"), []byte("meta"))
+
+	val, _, _ := eng.Get([]byte("k"))
+	if string(val) != "default" {
+		t.Fatalf("expected default k=default, got %s", val)
+	}
+	val, _, _ = eng.GetCF(meta, []byte("k"))
+	if string(val) != "meta" {
+		t.Fatalf("expected meta k=meta, got %s", val)
+	}
+
+	// one shared sequence counter
+	if eng.Sequence() != 2 {
+		t.Fatalf("expected seq=2, got %d", eng.Sequence())
+	}
+
+	_ = eng.DeleteCF(meta, []byte("k"))
+	if _, ok, _ := eng.GetCF(meta, []byte("k")); ok {
+		t.Fatalf("expected meta k to be deleted")
+	}
+	if _, ok, _ := eng.Get([]byte("k")); !ok {
+		t.Fatalf("expected default k to be untouched")
+	}
+}
+
+func TestColumnFamilyBatchAndRecovery(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+	blobs, _ := eng1.CreateColumnFamily("blobs", config.ColumnFamilyOptions{})
+	index, _ := eng1.CreateColumnFamily("index", config.ColumnFamilyOptions{})
+
+	b := engine.NewBatch()
+	b.PutCF(blobs, []byte("b1"), []byte("payload"))
+	b.PutCF(index, []byte("by-name/x"), []byte("b1"))
+	b.Put([]byte("count"), []byte("1"))
+	if err := eng1.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	_ = eng1.Close()
+
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng2.Close()
+
+	names := eng2.ColumnFamilies()
+	if len(names) != 3 || names[0] != "blobs" || names[1] != "default" || names[2] != "index" {
+		t.Fatalf("expected [blobs default index], got %v", names)
+	}
+
+	idx, ok := eng2.ColumnFamily("index")
+	if !ok {
+		t.Fatalf("expected index column family after recovery")
+	}
+	val, ok, _ := eng2.GetCF(idx, []byte("by-name/x"))
+	if !ok || string(val) != "b1" {
+		t.Fatalf("expected index by-name/x=b1 after recovery")
+	}
+}
+
+func TestColumnFamilyDrop(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+
+	tmp, _ := eng1.CreateColumnFamily("tmp", config.ColumnFamilyOptions{MemtableSizeBytes: 1})
+	_ = eng1.PutCF(tmp, []byte("a"), []byte("1")) // flushes into the tmp directory
+
+	files, _ := filepath.Glob(filepath.Join(cfg.ColumnFamilyDir(tmp.ID()), "*.sst"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 SSTable in column family dir, got %d", len(files))
+	}
+
+	if err := eng1.DropColumnFamily(eng1.DefaultColumnFamily()); !errors.Is(err, engine.ErrDropDefaultColumnFamily) {
+		t.Fatalf("expected ErrDropDefaultColumnFamily, got %v", err)
+	}
+	if err := eng1.DropColumnFamily(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cfg.ColumnFamilyDir(tmp.ID())); !os.IsNotExist(err) {
+		t.Fatalf("expected column family dir to be removed")
+	}
+	if err := eng1.PutCF(tmp, []byte("b"), []byte("2")); !errors.Is(err, engine.ErrColumnFamilyDropped) {
+		t.Fatalf("expected ErrColumnFamilyDropped, got %v", err)
+	}
+
+	// ids are not reused and the drop is durable
+	again, _ := eng1.CreateColumnFamily("tmp", config.ColumnFamilyOptions{})
+	if again.ID() == tmp.ID() {
+		t.Fatalf("expected a fresh id for the recreated column family")
+	}
+	_ = eng1.Close()
+
+	eng2, _ := engine.Open(cfg)
+	defer eng2.Close()
+
+	cf, ok := eng2.ColumnFamily("tmp")
+	if !ok || cf.ID() != again.ID() {
+		t.Fatalf("expected only the recreated tmp column family")
+	}
+	if _, ok, _ := eng2.GetCF(cf, []byte("a")); ok {
+		t.Fatalf("expected data of the dropped column family to be gone")
+	}
+}
+
+func TestColumnFamilyOptionsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+	small, err := eng1.CreateColumnFamily("small", config.ColumnFamilyOptions{MemtableSizeBytes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = eng1.Close()
+
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng2.Close()
+
+	small, _ = eng2.ColumnFamily("small")
+	_ = eng2.PutCF(small, []byte("a"), []byte("1")) // flushes with the recorded size
+
+	files, _ := filepath.Glob(filepath.Join(cfg.ColumnFamilyDir(small.ID()), "*.sst"))
+	if len(files) != 1 {
+		t.Fatalf("expected the recorded memtable size to flush, got %d SSTables", len(files))
+	}
+}
+
+func TestColumnFamilyMerge(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+	counters, _ := eng1.CreateColumnFamily("counters", config.ColumnFamilyOptions{MergeOperator: counterOp{}})
+
+	if err := eng1.Merge([]byte("n"), encodeCounter(1)); !errors.Is(err, engine.ErrNoMergeOperator) {
+		t.Fatalf("expected ErrNoMergeOperator on the default column family, got %v", err)
+	}
+	_ = eng1.MergeCF(counters, []byte("n"), encodeCounter(1))
+	b := engine.NewBatch()
+	b.MergeCF(counters, []byte("n"), encodeCounter(2))
+	if err := eng1.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	val, _, _ := eng1.GetCF(counters, []byte("n"))
+	if decodeCounter(val) != 3 {
+		t.Fatalf("expected n=3, got %d", decodeCounter(val))
+	}
+	_ = eng1.Close()
+
+	// the operator is not recorded, only its name
+	if _, err := engine.Open(cfg); !errors.Is(err, engine.ErrNoMergeOperator) {
+		t.Fatalf("expected ErrNoMergeOperator without the operator, got %v", err)
+	}
+
+	cfg.ColumnFamilies = map[string]config.ColumnFamilyOptions{"counters": {MergeOperator: counterOp{}}}
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng2.Close()
+
+	counters, _ = eng2.ColumnFamily("counters")
+	val, _, _ = eng2.GetCF(counters, []byte("n"))
+	if decodeCounter(val) != 3 {
+		t.Fatalf("expected n=3 after recovery, got %d", decodeCounter(val))
+	}
+}
+
+func TestColumnFamilyWritesCheckTheHandle(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+	other, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer other.Close()
+
+	local, _ := eng.CreateColumnFamily("local", config.ColumnFamilyOptions{})
+	foreign, _ := other.CreateColumnFamily("foreign", config.ColumnFamilyOptions{})
+	if local.ID() != foreign.ID() {
+		t.Fatalf("expected both column families to share an id")
+	}
+
+	for name, cf := range map[string]*engine.ColumnFamily{"nil": nil, "foreign": foreign} {
+		if err := eng.PutCF(cf, []byte("k"), []byte("v")); !errors.Is(err, engine.ErrColumnFamilyDropped) {
+			t.Fatalf("%s PutCF: expected ErrColumnFamilyDropped, got %v", name, err)
+		}
+		if err := eng.DeleteCF(cf, []byte("k")); !errors.Is(err, engine.ErrColumnFamilyDropped) {
+			t.Fatalf("%s DeleteCF: expected ErrColumnFamilyDropped, got %v", name, err)
+		}
+		if err := eng.DeleteRangeCF(cf, []byte("a"), []byte("z")); !errors.Is(err, engine.ErrColumnFamilyDropped) {
+			t.Fatalf("%s DeleteRangeCF: expected ErrColumnFamilyDropped, got %v", name, err)
+		}
+
+		b := engine.NewBatch()
+		b.Put([]byte("d"), []byte("v"))
+		b.PutCF(cf, []byte("k"), []byte("v"))
+		if err := eng.Write(b); !errors.Is(err, engine.ErrColumnFamilyDropped) {
+			t.Fatalf("%s batch: expected ErrColumnFamilyDropped, got %v", name, err)
+		}
+	}
+
+	if _, ok, _ := eng.GetCF(local, []byte("k")); ok {
+		t.Fatalf("expected nothing written to the local column family")
+	}
+	if _, ok, _ := eng.Get([]byte("d")); ok {
+		t.Fatalf("expected a rejected batch to write nothing")
+	}
+}
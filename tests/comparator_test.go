@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/memtable"
+	"vern_kv/sstable"
+)
+
+// Comparator Test
+
+// reverseComparator orders keys in descending byte order.
+type reverseComparator struct{}
+
+func (reverseComparator) Compare(a, b []byte) int { return bytes.Compare(b, a) }
+func (reverseComparator) Name() string            { return "test.Reverse" }
+
+// caseInsensitiveComparator treats ASCII letters case-insensitively.
+type caseInsensitiveComparator struct{}
+
+func (caseInsensitiveComparator) Compare(a, b []byte) int {
+	return bytes.Compare(bytes.ToLower(a), bytes.ToLower(b))
+}
+func (caseInsensitiveComparator) Name() string { return "test.CaseInsensitive" }
+
+func TestMemtableUsesComparator(t *testing.T) {
+	mt := memtable.NewWithOptions(memtable.Options{Comparator: reverseComparator{}})
+
+	mt.Put([]byte("a"), []byte("1"), 1)
+	mt.Put([]byte("c"), []byte("3"), 2)
+	mt.Put([]byte("b"), []byte("2"), 3)
+
+	entries := mt.AllEntriesSorted()
+	if len(entries) != 3 || string(entries[0].Key) != "c" || string(entries[2].Key) != "a" {
+		t.Fatalf("expected descending order c,b,a")
+	}
+}
+
+func TestEngineCaseInsensitiveComparator(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 1
+	cfg.Comparator = caseInsensitiveComparator{}
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	_ = eng.Put([]byte("User"), []byte("1")) // SSTable 1
+	_ = eng.Put([]byte("USER"), []byte("2")) // SSTable 2, same key
+
+	val, ok, _ := eng.Get([]byte("user"))
+	if !ok || string(val) != "2" {
+		t.Fatalf("expected user=2, got %q", val)
+	}
+
+	count := 0
+	_ = eng.ScanPrefix(nil, func(k, v []byte) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Fatalf("expected versions to collapse into one key, got %d", count)
+	}
+}
+
+func TestEngineReverseComparatorScanOrder(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 1
+	cfg.Comparator = reverseComparator{}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("t/1"), []byte("a"))
+	_ = eng.Put([]byte("t/3"), []byte("c"))
+	_ = eng.Put([]byte("t/2"), []byte("b"))
+
+	var got []string
+	_ = eng.ScanPrefix([]byte("t/"), func(k, v []byte) bool {
+		got = append(got, string(k))
+		return true
+	})
+	if len(got) != 3 || got[0] != "t/3" || got[1] != "t/2" || got[2] != "t/1" {
+		t.Fatalf("expected [t/3 t/2 t/1], got %v", got)
+	}
+
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	val, ok, _ := eng.Get([]byte("t/2"))
+	if !ok || string(val) != "b" {
+		t.Fatalf("expected t/2=b after compaction")
+	}
+}
+
+func TestOpenRefusesDifferentComparator(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	cfg.Comparator = reverseComparator{}
+
+	eng, _ := engine.Open(cfg)
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Close()
+
+	cfg.Comparator = nil
+	if _, err := engine.Open(cfg); !errors.Is(err, engine.ErrComparatorMismatch) {
+		t.Fatalf("expected ErrComparatorMismatch, got %v", err)
+	}
+
+	cfg.Comparator = reverseComparator{}
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatalf("expected reopen with same comparator, got %v", err)
+	}
+	_ = eng2.Close()
+}
+
+func TestSSTableComparator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sst")
+
+	unordered := []sstable.Entry{
+		{Key: []byte("a"), Seq: 1},
+		{Key: []byte("b"), Seq: 2},
+	}
+	opts := sstable.WriteOptions{Comparator: reverseComparator{}}
+	if err := sstable.WriteWithOptions(path, unordered, opts); err == nil {
+		t.Fatalf("expected out-of-order entries to be rejected")
+	}
+
+	ordered := []sstable.Entry{
+		{Key: []byte("b"), Value: []byte("2"), Seq: 2},
+		{Key: []byte("a"), Value: []byte("1"), Seq: 1},
+	}
+	if err := sstable.WriteWithOptions(path, ordered, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sstable.Open(path); !errors.Is(err, sstable.ErrComparatorMismatch) {
+		t.Fatalf("expected ErrComparatorMismatch, got %v", err)
+	}
+
+	st, err := sstable.OpenWithOptions(path, sstable.ReadOptions{Comparator: reverseComparator{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	e, ok, _ := st.Get([]byte("a"))
+	if !ok || string(e.Value) != "1" {
+		t.Fatalf("expected a=1")
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Conditional Write Test
+func TestPutIfAbsent(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	res, err := eng.PutIfAbsent([]byte("leader"), []byte("node-1"))
+	if err != nil || !res.Applied {
+		t.Fatalf("expected first PutIfAbsent to apply, got %+v %v", res, err)
+	}
+
+	res, _ = eng.PutIfAbsent([]byte("leader"), []byte("node-2"))
+	if res.Applied || !res.Found || string(res.Value) != "node-1" {
+		t.Fatalf("expected PutIfAbsent to report node-1, got %+v", res)
+	}
+
+	// a deleted key counts as absent
+	_ = eng.Delete([]byte("leader"))
+	res, _ = eng.PutIfAbsent([]byte("leader"), []byte("node-3"))
+	if !res.Applied {
+		t.Fatalf("expected PutIfAbsent to apply after delete")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	res, _ := eng.CompareAndSwap([]byte("k"), nil, []byte("1"))
+	if !res.Applied {
+		t.Fatalf("expected nil expected value to match missing key")
+	}
+
+	res, _ = eng.CompareAndSwap([]byte("k"), []byte("0"), []byte("2"))
+	if res.Applied || string(res.Value) != "1" {
+		t.Fatalf("expected mismatch to report current value 1, got %+v", res)
+	}
+
+	res, _ = eng.CompareAndSwap([]byte("k"), []byte("1"), []byte("2"))
+	if !res.Applied || string(res.Value) != "2" {
+		t.Fatalf("expected swap to apply, got %+v", res)
+	}
+
+	val, _, _ := eng.Get([]byte("k"))
+	if string(val) != "2" {
+		t.Fatalf("expected k=2 after swap")
+	}
+	if eng.Sequence() != 2 {
+		t.Fatalf("expected failed CAS to write nothing, seq=%d", eng.Sequence())
+	}
+}
+
+func TestCompareAndSwapIsAtomic(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("token"), []byte("free"))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := eng.CompareAndSwap([]byte("token"), []byte("free"), []byte("taken"))
+			if err == nil && res.Applied {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Fatalf("expected exactly one CAS winner, got %d", winners)
+	}
+}
+
+func TestDeleteIfEquals(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("k"), []byte("v1"))
+
+	res, _ := eng.DeleteIfEquals([]byte("k"), []byte("v0"))
+	if res.Applied || string(res.Value) != "v1" {
+		t.Fatalf("expected mismatch to keep k, got %+v", res)
+	}
+
+	res, _ = eng.DeleteIfEquals([]byte("k"), []byte("v1"))
+	if !res.Applied {
+		t.Fatalf("expected delete to apply")
+	}
+	if _, ok, _ := eng.Get([]byte("k")); ok {
+		t.Fatalf("expected k to be deleted")
+	}
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Context API Test
+
+// blockingOp is appendOp whose FullMerge waits for release, keeping the
+// engine busy inside a Get.
+type blockingOp struct {
+	appendOp
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (op blockingOp) FullMerge(key, existing []byte, operands [][]byte) []byte {
+	op.entered <- struct{}{}
+	<-op.release
+	return op.appendOp.FullMerge(key, existing, operands)
+}
+
+func TestCtxCancelledBeforeWrite(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b := engine.NewBatch()
+	b.Put([]byte("b"), []byte("2"))
+
+	if err := eng.PutCtx(ctx, []byte("a"), []byte("1")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("PutCtx: expected context.Canceled, got %v", err)
+	}
+	if err := eng.WriteCtx(ctx, b); !errors.Is(err, context.Canceled) {
+		t.Fatalf("WriteCtx: expected context.Canceled, got %v", err)
+	}
+	if _, _, err := eng.GetCtx(ctx, []byte("a")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetCtx: expected context.Canceled, got %v", err)
+	}
+	if eng.Sequence() != 0 {
+		t.Fatalf("expected no write to be logged, got seq %d", eng.Sequence())
+	}
+}
+
+func TestCtxDeadlineWhileEngineBusy(t *testing.T) {
+	op := blockingOp{entered: make(chan struct{}), release: make(chan struct{})}
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MergeOperator = op
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Merge([]byte("m"), []byte("x"))
+
+	done := make(chan struct{})
+	go func() {
+		_, _, _ = eng.Get([]byte("m"))
+		close(done)
+	}()
+	<-op.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := eng.PutCtx(ctx, []byte("a"), []byte("1")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	close(op.release)
+	<-done
+
+	if _, ok, _ := eng.Get([]byte("a")); ok {
+		t.Fatalf("expected the expired write not to be applied")
+	}
+	if err := eng.PutCtx(context.Background(), []byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	val, ok, err := eng.GetCtx(context.Background(), []byte("a"))
+	if err != nil || !ok || string(val) != "1" {
+		t.Fatalf("expected a=1, got %q %v %v", val, ok, err)
+	}
+}
+
+func TestScanPrefixCtxStopsOnCancel(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	for _, k := range []string{"p1", "p2", "p3"} {
+		_ = eng.Put([]byte(k), []byte("v"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var seen int
+	err := eng.ScanPrefixCtx(ctx, []byte("p"), func(k, v []byte) bool {
+		seen++
+		cancel()
+		return true
+	})
+	if !errors.Is(err, context.Canceled) || seen != 1 {
+		t.Fatalf("expected scan to stop after 1 key with context.Canceled, got %d keys, %v", seen, err)
+	}
+}
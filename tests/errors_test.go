@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/sstable"
+)
+
+// Typed Errors Test
+
+func TestClosedEngineReturnsErrClosed(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	_ = eng.Put([]byte("a"), []byte("1"))
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, getErr := eng.Get([]byte("a"))
+	_, lookupErr := eng.Lookup([]byte("a"))
+	_, _, multiErr := eng.MultiGet([][]byte{[]byte("a")})
+	_, condErr := eng.PutIfAbsent([]byte("b"), []byte("2"))
+	_, cfErr := eng.CreateColumnFamily("cf", config.ColumnFamilyOptions{})
+	_, _, txnErr := eng.BeginOptimistic().Get([]byte("a"))
+
+	errs := map[string]error{
+		"Put":                eng.Put([]byte("a"), []byte("2")),
+		"Delete":             eng.Delete([]byte("a")),
+		"Get":                getErr,
+		"Lookup":             lookupErr,
+		"MultiGet":           multiErr,
+		"Write":              eng.Write(engine.NewBatch()),
+		"ScanPrefix":         eng.ScanPrefix(nil, func(k, v []byte) bool { return true }),
+		"Compact":            eng.Compact(),
+		"PutIfAbsent":        condErr,
+		"CreateColumnFamily": cfErr,
+		"OptimisticTxn.Get":  txnErr,
+		"DeleteRange":        eng.DeleteRange([]byte("a"), []byte("b")),
+		"Flush":              eng.Flush(true),
+	}
+	for name, err := range errs {
+		if !errors.Is(err, engine.ErrClosed) {
+			t.Fatalf("%s: expected ErrClosed, got %v", name, err)
+		}
+	}
+}
+
+func TestLookupNotFound(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("2"))
+	_ = eng.Delete([]byte("b"))
+
+	if val, err := eng.Lookup([]byte("a")); err != nil || string(val) != "1" {
+		t.Fatalf("expected a=1, got %q %v", val, err)
+	}
+	for _, key := range []string{"b", "missing"} {
+		if _, err := eng.Lookup([]byte(key)); !errors.Is(err, engine.ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound, got %v", key, err)
+		}
+	}
+}
+
+func TestSSTableCorruptionError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.sst")
+	entries := []sstable.Entry{{Key: []byte("a"), Value: []byte("1"), Seq: 1}}
+	if err := sstable.Write(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xFF // break the magic
+	_ = os.WriteFile(path, data, 0644)
+
+	_, err := sstable.Open(path)
+	if !errors.Is(err, engine.ErrCorruption) {
+		t.Fatalf("expected ErrCorruption, got %v", err)
+	}
+
+	var corrupt *engine.CorruptionError
+	if !errors.As(err, &corrupt) || corrupt.File != path || corrupt.Offset != int64(len(data)-4) {
+		t.Fatalf("expected corruption at the magic of %s, got %v", path, err)
+	}
+}
+
+func TestWALCorruptionError(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+
+	eng, _ := engine.Open(cfg)
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Close()
+
+	walPath := filepath.Join(cfg.WALDir(), "wal.log")
+	info, _ := os.Stat(walPath)
+
+	// a record header promising more bytes than the log holds
+	f, _ := os.OpenFile(walPath, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 9, 0, 0, 0, 8, 0, 0, 0, 0, 1, 'k'})
+	f.Close()
+
+	_, err := engine.Open(cfg)
+
+	var corrupt *engine.CorruptionError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("expected *CorruptionError, got %v", err)
+	}
+	if corrupt.File != walPath || corrupt.Offset != info.Size() {
+		t.Fatalf("expected corruption at %s:%d, got %v", walPath, info.Size(), err)
+	}
+}
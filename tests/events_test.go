@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Event Listener Test
+
+// recordingListener logs event names; onFlush runs in OnFlushCompleted.
+type recordingListener struct {
+	config.NoopEventListener
+
+	mu      sync.Mutex
+	events  []string
+	flushes []config.FlushInfo
+	onFlush func()
+}
+
+func (l *recordingListener) record(name string) {
+	l.mu.Lock()
+	l.events = append(l.events, name)
+	l.mu.Unlock()
+}
+
+func (l *recordingListener) OnFlushBegin(info config.FlushInfo) {
+	l.record("flush-begin")
+}
+
+func (l *recordingListener) OnFlushCompleted(info config.FlushInfo) {
+	l.record("flush-completed")
+	l.mu.Lock()
+	l.flushes = append(l.flushes, info)
+	l.mu.Unlock()
+	if l.onFlush != nil {
+		l.onFlush()
+	}
+}
+
+func (l *recordingListener) OnTableFileCreated(info config.TableFileInfo) {
+	l.record("created " + filepath.Base(info.Path))
+}
+
+func (l *recordingListener) OnTableFileDeleted(info config.TableFileInfo) {
+	l.record("deleted " + filepath.Base(info.Path))
+}
+
+func TestEventListenerFlushAndCompaction(t *testing.T) {
+	l := &recordingListener{}
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.EventListener = l
+
+	eng, _ := engine.Open(cfg)
+
+	// would deadlock if called under the engine lock
+	l.onFlush = func() { _, _ = eng.GetProperty(engine.PropNumSSTables) }
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("2"))
+	_ = eng.Flush(true)
+	_ = eng.Put([]byte("c"), []byte("3"))
+	_ = eng.Flush(true)
+	_ = eng.Compact()
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.flushes) != 2 {
+		t.Fatalf("expected 2 flushes, got %v", l.events)
+	}
+	f := l.flushes[0]
+	if f.ColumnFamily != "default" || f.Entries != 2 || f.MinSeq != 1 || f.MaxSeq != 2 || f.Path == "" {
+		t.Fatalf("unexpected flush info %+v", f)
+	}
+
+	var created, deleted int
+	for _, ev := range l.events {
+		switch {
+		case strings.HasPrefix(ev, "created "):
+			created++
+		case strings.HasPrefix(ev, "deleted "):
+			deleted++
+		}
+	}
+	if created != 3 || deleted != 2 {
+		t.Fatalf("expected 3 created and 2 deleted tables, got %v", l.events)
+	}
+	if l.events[0] != "flush-begin" || l.events[2] != "flush-completed" {
+		t.Fatalf("expected begin, created, completed order, got %v", l.events)
+	}
+}
+
+func TestEventListenerSlowCallbackDoesNotBlockWrites(t *testing.T) {
+	release := make(chan struct{})
+	l := &recordingListener{onFlush: func() { <-release }}
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.EventListener = l
+
+	eng, _ := engine.Open(cfg)
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Flush(true)
+	for i := 0; i < 10; i++ {
+		if err := eng.Put([]byte("b"), []byte("2")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(release)
+	_ = eng.Close()
+}
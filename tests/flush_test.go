@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 
 	"vern_kv/config"
@@ -29,3 +31,159 @@ func TestMemtableFlushCreatesSSTable(t *testing.T) {
 		t.Fatalf("expected at least one SSTable")
 	}
 }
+
+func TestManualFlush(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	if err := eng.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := os.ReadDir(cfg.SSTableDir())
+	if len(files) != 1 {
+		t.Fatalf("expected 1 SSTable after Flush, got %d", len(files))
+	}
+	if _, ok := eng.MemtableGet([]byte("a")); ok {
+		t.Fatalf("expected an empty memtable after Flush")
+	}
+	if val, ok, _ := eng.Get([]byte("a")); !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 from the SSTable, got %q", val)
+	}
+
+	// nothing to flush
+	_ = eng.Flush(true)
+	files, _ = os.ReadDir(cfg.SSTableDir())
+	if len(files) != 1 {
+		t.Fatalf("expected an empty memtable not to be flushed, got %d SSTables", len(files))
+	}
+}
+
+func TestBackgroundFlushDrainedByClose(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	eng, _ := engine.Open(cfg)
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	if err := eng.Flush(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := os.ReadDir(cfg.SSTableDir())
+	if len(files) != 1 {
+		t.Fatalf("expected Close to wait for the background flush, got %d SSTables", len(files))
+	}
+}
+
+func TestCloseFlushesAndIsIdempotent(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.FlushOnClose = true
+	eng, _ := engine.Open(cfg)
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	if err := eng.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Close(); err != nil {
+		t.Fatalf("expected a second Close to succeed, got %v", err)
+	}
+
+	files, _ := os.ReadDir(cfg.SSTableDir())
+	if len(files) != 1 {
+		t.Fatalf("expected Close to flush the memtable, got %d SSTables", len(files))
+	}
+
+	// the LOCK file was released
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng2.Close()
+	if val, ok, _ := eng2.Get([]byte("a")); !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 after reopen, got %q", val)
+	}
+}
+
+func TestConcurrentWritersFlushInOrder(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 256
+
+	eng, _ := engine.Open(cfg)
+
+	// writers freeze memtables while others are being written
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := []byte(fmt.Sprintf("w%d-k%03d", w, i))
+				if err := eng.Put(key, []byte(fmt.Sprintf("v%d", i))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	_ = eng.Close()
+
+	eng, _ = engine.Open(cfg)
+	defer eng.Close()
+	for w := 0; w < 4; w++ {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("w%d-k%03d", w, i))
+			if val, _, _ := eng.Get(key); string(val) != fmt.Sprintf("v%d", i) {
+				t.Fatalf("expected %s=v%d, got %q", key, i, val)
+			}
+		}
+	}
+}
+
+func TestFailedFlushDoesNotFailLoggedWrite(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 32
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	// a file in place of the table directory makes every flush fail
+	if err := os.RemoveAll(cfg.SSTableDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.SSTableDir(), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := eng.CompareAndSwap([]byte("k"), nil, []byte("a value long enough to fill the memtable"))
+	if err != nil || !res.Applied {
+		t.Fatalf("expected the swap applied without error, got %+v, %v", res, err)
+	}
+	if val, ok, _ := eng.Get([]byte("k")); !ok || string(val) != "a value long enough to fill the memtable" {
+		t.Fatalf("expected the swapped value, got %q", val)
+	}
+	if n := intProperty(t, eng, engine.PropBackgroundErrors); n != 1 {
+		t.Fatalf("expected 1 background error, got %d", n)
+	}
+
+	// the frozen memtable is written by the next flush
+	if err := os.Remove(cfg.SSTableDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(cfg.SSTableDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if n := intProperty(t, eng, engine.PropNumSSTables); n != 1 {
+		t.Fatalf("expected the retried flush to write 1 table, got %d", n)
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/errs"
+	"vern_kv/sstable"
+	"vern_kv/wal"
+)
+
+// Decoder Fuzz Test
+//
+// The seed corpus runs with go test; explore further with e.g.
+//   go test ./tests -run '^$' -fuzz FuzzWALRecover
+
+// fuzzLimit keeps hostile length fields from allocating much.
+const fuzzLimit = 1 << 16
+
+// walSeed returns the bytes of a WAL holding every record type.
+func walSeed(t testing.TB) []byte {
+	dir := t.TempDir()
+	w, err := wal.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = w.AppendComparator(config.BytewiseComparator.Name())
+	_ = w.AppendPut(1, []byte("a"), []byte("1"))
+	_ = w.AppendPutTTL(2, []byte("b"), []byte("2"), 1000)
+	_ = w.AppendDelete(3, []byte("a"))
+	_ = w.AppendMerge(4, []byte("c"), []byte("+1"))
+	_ = w.AppendRangeDelete(5, []byte("d"), []byte("f"))
+	_ = w.AppendSingleDelete(6, []byte("g"))
+	_ = w.AppendBatch(7, []wal.Entry{
+		{Key: []byte("h"), Value: []byte("3")},
+		{Key: []byte("i"), Tombstone: true, CF: 1},
+	})
+	_ = w.AppendCreateColumnFamily(1, "cf", wal.ColumnFamilyOptions{})
+	_ = w.AppendPrepare("tx", []wal.Entry{{Key: []byte("j"), Value: []byte("4")}})
+	_ = w.AppendCommitPrepared(9, "tx")
+	_ = w.AppendDropColumnFamily(1, "cf")
+	_ = w.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func FuzzWALRecover(f *testing.F) {
+	seed := walSeed(f)
+	f.Add(seed)
+	f.Add(seed[:len(seed)-3])
+	f.Add([]byte{})
+	f.Add(make([]byte, 17))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "wal.log"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, readOnly := range []bool{false, true} {
+			w, err := wal.OpenWithOptions(dir, wal.Options{
+				ReadOnly:     readOnly,
+				MaxKeySize:   fuzzLimit,
+				MaxValueSize: fuzzLimit,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Recover(0); err != nil && !errors.Is(err, errs.ErrCorruption) {
+				t.Fatalf("expected corruption error, got %v", err)
+			}
+			_ = w.Close()
+		}
+	})
+}
+
+// sstableSeed returns the bytes of a table using every block and flag.
+func sstableSeed(t testing.TB) []byte {
+	path := filepath.Join(t.TempDir(), "seed.sst")
+	entries := []sstable.Entry{
+		{Key: []byte("a1"), Value: []byte("1"), Seq: 1},
+		{Key: []byte("a2"), Seq: 2, Tombstone: true},
+		{Key: []byte("b1"), Seq: 3, Merge: true, Operands: [][]byte{[]byte("x"), []byte("y")}},
+		{Key: []byte("b2"), Value: []byte("2"), Seq: 4, ExpiresAt: 1000},
+		{Key: []byte("c1"), Seq: 5, Tombstone: true, SingleDelete: true},
+	}
+	err := sstable.WriteWithOptions(path, entries, sstable.WriteOptions{
+		PrefixExtractor: func(key []byte) []byte { return key[:1] },
+		RangeTombstones: []sstable.RangeTombstone{{Start: []byte("d"), End: []byte("f"), Seq: 6}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func FuzzSSTableOpen(f *testing.F) {
+	seed := sstableSeed(f)
+	f.Add(seed)
+	f.Add(seed[:len(seed)-1])
+	f.Add(seed[len(seed)-36:])
+	f.Add([]byte("TKV1"))
+	f.Add([]byte("TKV2"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		path := filepath.Join(t.TempDir(), "fuzz.sst")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		st, err := sstable.OpenWithOptions(path, sstable.ReadOptions{
+			MaxKeySize:   fuzzLimit,
+			MaxValueSize: fuzzLimit,
+		})
+		if err != nil {
+			if !errors.Is(err, errs.ErrCorruption) && !errors.Is(err, sstable.ErrComparatorMismatch) {
+				t.Fatalf("expected corruption error, got %v", err)
+			}
+			return
+		}
+		defer st.Close()
+
+		entries, err := st.ScanPrefix(nil)
+		if err != nil && !errors.Is(err, errs.ErrCorruption) {
+			t.Fatalf("expected corruption error, got %v", err)
+		}
+		for _, e := range entries {
+			if _, _, err := st.Get(e.Key); err != nil && !errors.Is(err, errs.ErrCorruption) {
+				t.Fatalf("expected corruption error, got %v", err)
+			}
+		}
+		_ = st.RangeTombstones()
+		_ = st.PrefixFilter()
+	})
+}
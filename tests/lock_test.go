@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Directory Lock Test
+
+func TestOpenLocksDataDir(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.DataDir, "LOCK")); err != nil {
+		t.Fatalf("expected LOCK file: %v", err)
+	}
+
+	_, err = engine.Open(cfg)
+	if !errors.Is(err, engine.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	var locked *engine.LockedError
+	if !errors.As(err, &locked) || locked.PID != os.Getpid() {
+		t.Fatalf("expected owner pid %d, got %v", os.Getpid(), err)
+	}
+
+	_ = eng.Close()
+
+	eng, err = engine.Open(cfg)
+	if err != nil {
+		t.Fatalf("expected Open after Close to succeed, got %v", err)
+	}
+	_ = eng.Close()
+}
+
+func TestReadOnlyOpenIgnoresLock(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+	_ = eng.Put([]byte("a"), []byte("1"))
+
+	reader, err := engine.OpenReadOnly(cfg)
+	if err != nil {
+		t.Fatalf("expected read-only open to be permitted, got %v", err)
+	}
+	defer reader.Close()
+
+	if val, ok, _ := reader.Get([]byte("a")); !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 from read-only engine")
+	}
+}
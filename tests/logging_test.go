@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Engine Log Test
+
+// decodes one JSON record per line.
+func readLogRecords(t *testing.T, data []byte) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var rec map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("expected a JSON log line, got %q: %v", sc.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+// returns the first record with msg, or nil.
+func findLogRecord(records []map[string]any, msg string) map[string]any {
+	for _, rec := range records {
+		if rec["msg"] == msg {
+			return rec
+		}
+	}
+	return nil
+}
+
+func TestDefaultLogFile(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+
+	eng, _ := engine.Open(cfg)
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("2"))
+	_ = eng.Flush(true)
+	_ = eng.Compact()
+	_ = eng.Close()
+
+	eng, _ = engine.Open(cfg)
+	_ = eng.Close()
+
+	// the first run's LOG was rotated away by the second Open
+	rotated, _ := filepath.Glob(filepath.Join(cfg.DataDir, "LOG.old.*"))
+	if len(rotated) != 1 {
+		t.Fatalf("expected 1 rotated LOG file, got %d", len(rotated))
+	}
+	data, err := os.ReadFile(rotated[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readLogRecords(t, data)
+
+	flush := findLogRecord(records, "flush")
+	if flush == nil || flush["cf"] != "default" || flush["entries"] != float64(2) || flush["max_seq"] != float64(2) {
+		t.Fatalf("expected a flush record, got %v", records)
+	}
+	for _, msg := range []string{"recovered", "compaction", "table deleted", "closed"} {
+		if findLogRecord(records, msg) == nil {
+			t.Fatalf("expected a %q record, got %v", msg, records)
+		}
+	}
+
+	data, _ = os.ReadFile(filepath.Join(cfg.DataDir, "LOG"))
+	recovered := findLogRecord(readLogRecords(t, data), "recovered")
+	if recovered == nil || recovered["records"] != float64(0) || recovered["tables"] != float64(1) || recovered["max_seq"] != float64(2) {
+		t.Fatalf("expected a recovery summary of 1 table and no replayed records, got %s", data)
+	}
+}
+
+func TestConfiguredLogger(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+	eng, _ := engine.Open(cfg)
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Close()
+
+	if _, err := os.Stat(filepath.Join(cfg.DataDir, "LOG")); !os.IsNotExist(err) {
+		t.Fatalf("expected no LOG file with a configured logger")
+	}
+	if findLogRecord(readLogRecords(t, buf.Bytes()), "recovered") == nil {
+		t.Fatalf("expected the configured logger to receive records, got %s", buf.Bytes())
+	}
+}
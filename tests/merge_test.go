@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/memtable"
+)
+
+// Merge Operator Test
+
+// counterOp adds big-endian uint64 operands.
+type counterOp struct{}
+
+func (counterOp) Name() string { return "test.counter" }
+
+func (counterOp) FullMerge(key, existing []byte, operands [][]byte) []byte {
+	sum := decodeCounter(existing)
+	for _, op := range operands {
+		sum += decodeCounter(op)
+	}
+	return encodeCounter(sum)
+}
+
+func (counterOp) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	return encodeCounter(decodeCounter(left) + decodeCounter(right)), true
+}
+
+// appendOp joins operands with ','; it cannot merge partially.
+type appendOp struct{}
+
+func (appendOp) Name() string { return "test.append" }
+
+func (appendOp) FullMerge(key, existing []byte, operands [][]byte) []byte {
+	out := append([]byte(nil), existing...)
+	for _, op := range operands {
+		if len(out) > 0 {
+			out = append(out, ',')
+		}
+		out = append(out, op...)
+	}
+	return out
+}
+
+func (appendOp) PartialMerge(key, left, right []byte) ([]byte, bool) {
+	return nil, false
+}
+
+func encodeCounter(n uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	return buf
+}
+
+func decodeCounter(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func TestMergeCounterInMemtable(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MergeOperator = counterOp{}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("hits"), encodeCounter(10))
+	for i := 0; i < 5; i++ {
+		if err := eng.Merge([]byte("hits"), encodeCounter(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	val, ok, _ := eng.Get([]byte("hits"))
+	if !ok || decodeCounter(val) != 15 {
+		t.Fatalf("expected hits=15, got %d", decodeCounter(val))
+	}
+}
+
+func TestMergeAcrossSSTablesAndCompact(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	cfg.MemtableSizeBytes = 1
+	cfg.MergeOperator = appendOp{}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("list"), []byte("a"))   // SSTable 1
+	_ = eng.Merge([]byte("list"), []byte("b")) // SSTable 2
+	_ = eng.Merge([]byte("list"), []byte("c")) // SSTable 3
+	_ = eng.Put([]byte("gone"), []byte("x"))
+	_ = eng.Delete([]byte("gone"))
+
+	val, ok, _ := eng.Get([]byte("list"))
+	if !ok || string(val) != "a,b,c" {
+		t.Fatalf("expected list=a,b,c, got %q", val)
+	}
+
+	var scanned string
+	_ = eng.ScanPrefix([]byte("li"), func(k, v []byte) bool {
+		scanned = string(v)
+		return true
+	})
+	if scanned != "a,b,c" {
+		t.Fatalf("expected scan to fold operands, got %q", scanned)
+	}
+
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := os.ReadDir(cfg.SSTableDir())
+	if len(files) != 1 {
+		t.Fatalf("expected 1 SSTable after compaction, got %d", len(files))
+	}
+
+	val, ok, _ = eng.Get([]byte("list"))
+	if !ok || string(val) != "a,b,c" {
+		t.Fatalf("expected list=a,b,c after compaction, got %q", val)
+	}
+	if _, ok, _ := eng.Get([]byte("gone")); ok {
+		t.Fatalf("expected deleted key to stay deleted after compaction")
+	}
+}
+
+func TestMergeRecoveredFromWAL(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	cfg.MergeOperator = counterOp{}
+
+	eng1, _ := engine.Open(cfg)
+	_ = eng1.Merge([]byte("n"), encodeCounter(2))
+	_ = eng1.Merge([]byte("n"), encodeCounter(3))
+	_ = eng1.Close()
+
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, _, _ := eng2.Get([]byte("n"))
+	if decodeCounter(val) != 5 {
+		t.Fatalf("expected n=5 after recovery, got %d", decodeCounter(val))
+	}
+	_ = eng2.Close()
+
+	cfg.MergeOperator = nil
+	if _, err := engine.Open(cfg); !errors.Is(err, engine.ErrNoMergeOperator) {
+		t.Fatalf("expected ErrNoMergeOperator, got %v", err)
+	}
+}
+
+func TestMergeRequiresOperator(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	if err := eng.Merge([]byte("k"), []byte("v")); !errors.Is(err, engine.ErrNoMergeOperator) {
+		t.Fatalf("expected ErrNoMergeOperator, got %v", err)
+	}
+}
+
+func TestMemtablePartialMergeCollapsesOperands(t *testing.T) {
+	mt := memtable.NewWithOptions(memtable.Options{MergeOperator: counterOp{}})
+
+	for i := uint64(1); i <= 100; i++ {
+		mt.Merge([]byte("k"), encodeCounter(1), i)
+	}
+
+	e, ok := mt.Get([]byte("k"))
+	if !ok || !e.Merge {
+		t.Fatalf("expected unresolved merge entry")
+	}
+	if len(e.Operands) != 1 || decodeCounter(e.Operands[0]) != 100 {
+		t.Fatalf("expected one collapsed operand of 100, got %d operands", len(e.Operands))
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// MultiGet Test
+
+func TestMultiGetInputOrder(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	for i := 0; i < 30; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("k%02d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+	_ = eng.Delete([]byte("k05"))
+	_ = eng.Put([]byte("k07"), []byte("new"))
+
+	keys := [][]byte{
+		[]byte("k29"), []byte("missing"), []byte("k00"),
+		[]byte("k05"), []byte("k07"), []byte("k00"),
+	}
+	values, found, err := eng.MultiGet(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"v29", "", "v0", "", "new", "v0"}
+	for i, w := range want {
+		if found[i] != (w != "") || string(values[i]) != w {
+			t.Fatalf("key %s: expected %q, got %q (found=%v)", keys[i], w, values[i], found[i])
+		}
+	}
+}
+
+func TestMultiGetMatchesGet(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 256
+	cfg.MergeOperator = appendOp{}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	for i := 0; i < 300; i++ {
+		key := []byte(fmt.Sprintf("key%03d", i%100))
+		switch i % 7 {
+		case 0:
+			_ = eng.Delete(key)
+		case 1, 2:
+			_ = eng.Merge(key, []byte(fmt.Sprint(i)))
+		default:
+			_ = eng.Put(key, []byte(fmt.Sprint(i)))
+		}
+	}
+	_ = eng.DeleteRange([]byte("key040"), []byte("key050"))
+
+	var keys [][]byte
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 110; i++ {
+			keys = append(keys, []byte(fmt.Sprintf("key%03d", i)))
+		}
+	}
+
+	for _, parallelism := range []int{0, 4} {
+		values, found, err := eng.MultiGetWithOptions(keys, engine.MultiGetOptions{Parallelism: parallelism})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, key := range keys {
+			val, ok, _ := eng.Get(key)
+			if ok != found[i] || string(val) != string(values[i]) {
+				t.Fatalf("parallelism %d, key %s: Get=%q/%v MultiGet=%q/%v",
+					parallelism, key, val, ok, values[i], found[i])
+			}
+		}
+	}
+}
+
+func TestMultiGetEmpty(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	values, found, err := eng.MultiGet(nil)
+	if err != nil || len(values) != 0 || len(found) != 0 {
+		t.Fatalf("expected empty results, got %v %v %v", values, found, err)
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/wal"
+)
+
+// Optimistic Transaction Test
+func TestOptimisticTxnCommit(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = eng.Put([]byte("balance/a"), []byte("10"))
+
+	txn := eng.BeginOptimistic()
+	if _, ok, _ := txn.Get([]byte("balance/a")); !ok {
+		t.Fatalf("expected balance/a to exist")
+	}
+	_ = txn.Put([]byte("balance/a"), []byte("5"))
+	_ = txn.Put([]byte("balance/b"), []byte("5"))
+
+	// read-your-own-writes
+	val, ok, _ := txn.Get([]byte("balance/b"))
+	if !ok || string(val) != "5" {
+		t.Fatalf("expected txn to see its own write")
+	}
+
+	// not visible before commit
+	if _, ok, _ := eng.Get([]byte("balance/b")); ok {
+		t.Fatalf("expected buffered write to be invisible")
+	}
+
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if eng.Sequence() != 3 {
+		t.Fatalf("expected seq=3, got %d", eng.Sequence())
+	}
+	_ = eng.Close()
+
+	// batch must survive recovery
+	eng2, _ := engine.Open(cfg)
+	defer eng2.Close()
+
+	for k, want := range map[string]string{"balance/a": "5", "balance/b": "5"} {
+		val, ok, _ := eng2.Get([]byte(k))
+		if !ok || string(val) != want {
+			t.Fatalf("expected %s=%s after recovery", k, want)
+		}
+	}
+}
+
+func TestOptimisticTxnConflict(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+
+	txn := eng.BeginOptimistic()
+	_, _, _ = txn.Get([]byte("a"))
+	_, _, _ = txn.Get([]byte("missing"))
+	_ = txn.Put([]byte("b"), []byte("2"))
+
+	_ = eng.Put([]byte("missing"), []byte("now-present"))
+
+	if err := txn.Commit(); !errors.Is(err, engine.ErrConflict) {
+		t.Fatalf("expected ErrConflict, got %v", err)
+	}
+	if _, ok, _ := eng.Get([]byte("b")); ok {
+		t.Fatalf("expected conflicting txn writes to be discarded")
+	}
+	if err := txn.Commit(); !errors.Is(err, engine.ErrTxnDone) {
+		t.Fatalf("expected ErrTxnDone, got %v", err)
+	}
+}
+
+func TestOptimisticTxnRollback(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	txn := eng.BeginOptimistic()
+	_ = txn.Put([]byte("a"), []byte("1"))
+	txn.Rollback()
+
+	if _, ok, _ := eng.Get([]byte("a")); ok {
+		t.Fatalf("expected rolled back write to be discarded")
+	}
+	if eng.Sequence() != 0 {
+		t.Fatalf("expected seq=0, got %d", eng.Sequence())
+	}
+}
+
+func TestWALBatchReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := wal.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	_ = w.AppendPut(1, []byte("a"), []byte("1"))
+	_ = w.AppendBatch(2, []wal.Entry{
+		{Key: []byte("b"), Value: []byte("2")},
+		{Key: []byte("a"), Tombstone: true},
+	})
+
+	entries, err := w.Replay(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	if entries[2].Seq != 3 || !entries[2].Tombstone {
+		t.Fatalf("expected tombstone for a at seq 3")
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Pessimistic Transaction Test
+func openLockingEngine(t *testing.T, timeout time.Duration) *engine.Engine {
+	t.Helper()
+
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.LockTimeout = timeout
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eng.Close() })
+	return eng
+}
+
+func TestPessimisticTxnCommit(t *testing.T) {
+	eng := openLockingEngine(t, time.Second)
+
+	txn := eng.BeginPessimistic()
+	_ = txn.Put([]byte("a"), []byte("1"))
+	_ = txn.Delete([]byte("b"))
+
+	val, ok, _ := txn.Get([]byte("a"))
+	if !ok || string(val) != "1" {
+		t.Fatalf("expected txn to see its own write")
+	}
+
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	val, ok, _ = eng.Get([]byte("a"))
+	if !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 after commit")
+	}
+	if err := txn.Put([]byte("a"), []byte("2")); !errors.Is(err, engine.ErrTxnDone) {
+		t.Fatalf("expected ErrTxnDone, got %v", err)
+	}
+}
+
+func TestPessimisticTxnSharedLocksCoexist(t *testing.T) {
+	eng := openLockingEngine(t, 50*time.Millisecond)
+
+	t1 := eng.BeginPessimistic()
+	t2 := eng.BeginPessimistic()
+	defer t1.Rollback()
+	defer t2.Rollback()
+
+	if _, _, err := t1.Get([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := t2.Get([]byte("a")); err != nil {
+		t.Fatalf("expected shared locks to coexist, got %v", err)
+	}
+	if err := t2.Put([]byte("a"), []byte("x")); !errors.Is(err, engine.ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout on upgrade, got %v", err)
+	}
+}
+
+func TestPessimisticTxnWaiterProceedsAfterCommit(t *testing.T) {
+	eng := openLockingEngine(t, time.Second)
+
+	t1 := eng.BeginPessimistic()
+	_ = t1.Put([]byte("a"), []byte("1"))
+
+	done := make(chan error, 1)
+	go func() {
+		t2 := eng.BeginPessimistic()
+		defer t2.Rollback()
+
+		val, _, err := t2.GetForUpdate([]byte("a"))
+		if err == nil && string(val) != "1" {
+			err = errors.New("expected to read committed a=1")
+		}
+		done <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := t1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPessimisticTxnDeadlockDetected(t *testing.T) {
+	eng := openLockingEngine(t, 2*time.Second)
+
+	t1 := eng.BeginPessimistic()
+	t2 := eng.BeginPessimistic()
+
+	_ = t1.Put([]byte("a"), []byte("1"))
+	_ = t2.Put([]byte("b"), []byte("2"))
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- t1.Put([]byte("b"), []byte("1")) // waits for t2
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+
+	start := time.Now()
+	if err := t2.Put([]byte("a"), []byte("2")); !errors.Is(err, engine.ErrDeadlock) {
+		t.Fatalf("expected ErrDeadlock, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected deadlock to be detected without waiting for timeout")
+	}
+
+	t2.Rollback()
+	if err := <-blocked; err != nil {
+		t.Fatalf("expected t1 to proceed after t2 rollback, got %v", err)
+	}
+	if err := t1.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPessimisticTxnZeroLockTimeoutWaits(t *testing.T) {
+	eng, err := engine.Open(config.Config{DataDir: t.TempDir(), MemtableSizeBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	t1 := eng.BeginPessimistic()
+	_ = t1.Put([]byte("a"), []byte("1"))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = t1.Commit()
+	}()
+
+	// an unset LockTimeout waits DefaultLockTimeout instead of failing at once
+	t2 := eng.BeginPessimistic()
+	defer t2.Rollback()
+	if err := t2.Put([]byte("a"), []byte("2")); err != nil {
+		t.Fatalf("expected the lock to be granted once t1 commits, got %v", err)
+	}
+}
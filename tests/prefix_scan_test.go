@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/sstable"
+)
+
+// Prefix Scan Test
+func TestScanPrefixMergesMemtableAndSSTables(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	cfg.MemtableSizeBytes = 1
+	cfg.PrefixExtractor = config.DelimitedPrefix('/', 2)
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	_ = eng.Put([]byte("tenant/1/b"), []byte("old"))
+	_ = eng.Put([]byte("tenant/1/a"), []byte("1"))
+	_ = eng.Put([]byte("tenant/2/a"), []byte("x"))
+	_ = eng.Put([]byte("tenant/1/b"), []byte("2"))
+	_ = eng.Put([]byte("tenant/1/c"), []byte("3"))
+	_ = eng.Delete([]byte("tenant/1/c"))
+
+	var got []string
+	err = eng.ScanPrefix([]byte("tenant/1/"), func(k, v []byte) bool {
+		got = append(got, string(k)+"="+string(v))
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"tenant/1/a=1", "tenant/1/b=2"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestScanPrefixStopsEarly(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("p/a"), []byte("1"))
+	_ = eng.Put([]byte("p/b"), []byte("2"))
+	_ = eng.Put([]byte("q/a"), []byte("3"))
+
+	count := 0
+	_ = eng.ScanPrefix([]byte("p/"), func(k, v []byte) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Fatalf("expected scan to stop after 1 key, got %d", count)
+	}
+}
+
+func TestScanPrefixSkipsTablesWithoutPrefix(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	cfg.MemtableSizeBytes = 1
+	cfg.PrefixExtractor = config.DelimitedPrefix('/', 2)
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("tenant/2/a"), []byte("x")) // SSTable 1
+
+	// Remove tenant 2's table: a scan that opened it would fail.
+	files, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 SSTable, got %d", len(files))
+	}
+	_ = os.Remove(files[0])
+
+	_ = eng.Put([]byte("tenant/1/a"), []byte("1")) // SSTable 2
+
+	var got []string
+	err := eng.ScanPrefix([]byte("tenant/1/"), func(k, v []byte) bool {
+		got = append(got, string(k))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("expected filtered table to be skipped, got %v", err)
+	}
+	if len(got) != 1 || got[0] != "tenant/1/a" {
+		t.Fatalf("expected [tenant/1/a], got %v", got)
+	}
+}
+
+func TestSSTablePrefixFilterPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sst")
+
+	entries := []sstable.Entry{
+		{Key: []byte("tenant/1/a"), Value: []byte("1"), Seq: 1},
+		{Key: []byte("tenant/3/a"), Value: []byte("3"), Seq: 2},
+	}
+	opts := sstable.WriteOptions{PrefixExtractor: config.DelimitedPrefix('/', 2)}
+	if err := sstable.WriteWithOptions(path, entries, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sstable.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	f := st.PrefixFilter()
+	if !f.MayContain([]byte("tenant/1/")) || !f.MayContain([]byte("tenant/")) {
+		t.Fatalf("expected filter to match stored prefixes")
+	}
+	if f.MayContain([]byte("tenant/2/")) {
+		t.Fatalf("expected filter to exclude tenant/2/")
+	}
+
+	found, err := st.ScanPrefix([]byte("tenant/3/"))
+	if err != nil || len(found) != 1 || string(found[0].Value) != "3" {
+		t.Fatalf("expected tenant/3/a=3 from table scan")
+	}
+}
+
+func TestScanPrefixDoesNotBlockWriters(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	for i := 0; i < 50; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("p/%02d", i)), []byte("v"))
+	}
+
+	// fn may write: the scan keeps reading the snapshot taken at call time
+	var got []string
+	err := eng.ScanPrefix([]byte("p/"), func(k, v []byte) bool {
+		got = append(got, string(k))
+		if err := eng.Put([]byte("p/99"), []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		_ = eng.Delete([]byte("p/49"))
+		return len(got) < 50
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 50 || got[49] != "p/49" {
+		t.Fatalf("expected the 50 keys of the snapshot, got %d ending with %q", len(got), got[len(got)-1])
+	}
+
+	if val, ok, _ := eng.Get([]byte("p/99")); !ok || string(val) != "new" {
+		t.Fatalf("expected the write made during the scan, got %q", val)
+	}
+}
+
+func TestSSTablePrefixIterator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sst")
+
+	var entries []sstable.Entry
+	for i, k := range []string{"a/1", "b/1", "b/2", "b/3", "c/1"} {
+		entries = append(entries, sstable.Entry{Key: []byte(k), Value: []byte(k), Seq: uint64(i + 1)})
+	}
+	if err := sstable.Write(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sstable.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	var got []string
+	it := st.NewPrefixIterator([]byte("b/"))
+	for {
+		e, ok, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, string(e.Key))
+	}
+	if fmt.Sprint(got) != "[b/1 b/2 b/3]" {
+		t.Fatalf("expected [b/1 b/2 b/3], got %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Property Query Test
+
+func intProperty(t *testing.T, eng *engine.Engine, name string) int64 {
+	t.Helper()
+	val, ok := eng.GetProperty(name)
+	if !ok {
+		t.Fatalf("expected property %s", name)
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		t.Fatalf("%s: expected an integer, got %q", name, val)
+	}
+	return n
+}
+
+func TestGetProperty(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("2"))
+	_ = eng.Flush(true)
+	_ = eng.Put([]byte("c"), []byte("3"))
+
+	want := map[string]int64{
+		engine.PropNumSSTables:           1,
+		engine.PropNumImmutableMemtables: 0,
+		engine.PropLastSequence:          3,
+		engine.PropEstimateNumKeys:       3,
+		engine.PropBackgroundErrors:      0,
+	}
+	for name, n := range want {
+		if got := intProperty(t, eng, name); got != n {
+			t.Fatalf("%s: expected %d, got %d", name, n, got)
+		}
+	}
+	if intProperty(t, eng, engine.PropMemtableBytes) == 0 {
+		t.Fatalf("expected the memtable holding c to be counted")
+	}
+	if intProperty(t, eng, engine.PropWALBytes) == 0 {
+		t.Fatalf("expected a non-empty WAL")
+	}
+
+	if _, ok := eng.GetProperty("vern.unknown"); ok {
+		t.Fatalf("expected an unknown property to be refused")
+	}
+}
+
+func TestSSTableSummaryProperty(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("2"))
+	_ = eng.Flush(true)
+	_ = eng.Put([]byte("c"), []byte("3"))
+	_ = eng.Flush(true)
+
+	summary, ok := eng.GetProperty(engine.PropSSTableSummary)
+	if !ok {
+		t.Fatalf("expected an SSTable summary")
+	}
+	lines := strings.Split(strings.TrimSpace(summary), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 tables, got:\n%s", summary)
+	}
+
+	first, second := strings.Fields(lines[1]), strings.Fields(lines[2])
+	if first[0] != "default" || first[3] != "2" || first[4] != "1-2" {
+		t.Fatalf("unexpected first table line %q", lines[1])
+	}
+	if second[3] != "1" || second[4] != "3-3" {
+		t.Fatalf("unexpected second table line %q", lines[2])
+	}
+}
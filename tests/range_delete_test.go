@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/sstable"
+)
+
+// Range Delete Test
+
+func TestDeleteRangeHidesCoveredKeys(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	for _, k := range []string{"t1/a", "t1/b", "t2/a", "t3/a"} {
+		_ = eng.Put([]byte(k), []byte("v"))
+	}
+
+	if err := eng.DeleteRange([]byte("t1/"), []byte("t3/")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"t1/a", "t1/b", "t2/a"} {
+		if _, ok, _ := eng.Get([]byte(k)); ok {
+			t.Fatalf("expected %s to be deleted", k)
+		}
+	}
+	if _, ok, _ := eng.Get([]byte("t3/a")); !ok {
+		t.Fatalf("expected end key to be exclusive")
+	}
+
+	// newer writes are not covered
+	_ = eng.Put([]byte("t1/a"), []byte("new"))
+	val, ok, _ := eng.Get([]byte("t1/a"))
+	if !ok || string(val) != "new" {
+		t.Fatalf("expected write after DeleteRange to be visible")
+	}
+
+	var keys []string
+	_ = eng.ScanPrefix([]byte("t"), func(k, v []byte) bool {
+		keys = append(keys, string(k))
+		return true
+	})
+	if fmt.Sprint(keys) != "[t1/a t3/a]" {
+		t.Fatalf("unexpected scan result %v", keys)
+	}
+}
+
+func TestDeleteRangeInvalidRange(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	if err := eng.DeleteRange([]byte("b"), []byte("a")); !errors.Is(err, engine.ErrInvalidRange) {
+		t.Fatalf("expected ErrInvalidRange, got %v", err)
+	}
+	if err := eng.DeleteRange([]byte("a"), []byte("a")); !errors.Is(err, engine.ErrInvalidRange) {
+		t.Fatalf("expected ErrInvalidRange for empty range, got %v", err)
+	}
+}
+
+func TestDeleteRangeCoversSSTables(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	for i := 0; i < 20; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("k%02d", i)), []byte("value"))
+	}
+
+	if err := eng.DeleteRange([]byte("k05"), []byte("k15")); err != nil {
+		t.Fatal(err)
+	}
+
+	// push the range tombstone into a table of its own
+	for i := 0; i < 10; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("z%02d", i)), []byte("value"))
+	}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		_, ok, err := eng.Get([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if covered := i >= 5 && i < 15; ok == covered {
+			t.Fatalf("key %s: visible=%v, covered=%v", key, ok, covered)
+		}
+	}
+}
+
+func TestDeleteRangePersistedInSSTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "range.sst")
+
+	entries := []sstable.Entry{{Key: []byte("a"), Value: []byte("1"), Seq: 1}}
+	opts := sstable.WriteOptions{
+		RangeTombstones: []sstable.RangeTombstone{{Start: []byte("a"), End: []byte("m"), Seq: 2}},
+	}
+	if err := sstable.WriteWithOptions(path, entries, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := sstable.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	dels := st.RangeTombstones()
+	if len(dels) != 1 || string(dels[0].Start) != "a" || string(dels[0].End) != "m" || dels[0].Seq != 2 {
+		t.Fatalf("unexpected range tombstones %+v", dels)
+	}
+}
+
+func TestDeleteRangeRecovery(t *testing.T) {
+	dir := t.TempDir()
+
+	eng, _ := engine.Open(config.DefaultConfig(dir))
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("2"))
+	_ = eng.DeleteRange([]byte("a"), []byte("b"))
+	_ = eng.Close()
+
+	eng, _ = engine.Open(config.DefaultConfig(dir))
+	defer eng.Close()
+
+	if _, ok, _ := eng.Get([]byte("a")); ok {
+		t.Fatalf("expected range tombstone to survive restart")
+	}
+	if _, ok, _ := eng.Get([]byte("b")); !ok {
+		t.Fatalf("expected b to survive restart")
+	}
+}
+
+func TestDeleteRangeMergeOperands(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MergeOperator = appendOp{}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("c"), []byte("base"))
+	_ = eng.Merge([]byte("c"), []byte("x"))
+	_ = eng.DeleteRange([]byte("a"), []byte("z"))
+	_ = eng.Merge([]byte("c"), []byte("y"))
+
+	val, ok, _ := eng.Get([]byte("c"))
+	if !ok || string(val) != "y" {
+		t.Fatalf("expected operands before the range tombstone to be dropped, got %q", val)
+	}
+}
+
+func TestCompactDropsRangeDeletedData(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	for i := 0; i < 20; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("k%02d", i)), []byte("value"))
+	}
+	_ = eng.DeleteRange([]byte("k00"), []byte("k10"))
+	for i := 0; i < 10; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("z%02d", i)), []byte("value"))
+	}
+
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(files) != 1 {
+		t.Fatalf("expected one table after compaction, got %d", len(files))
+	}
+
+	st, err := sstable.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	all, _ := st.ScanPrefix(nil)
+	for _, e := range all {
+		if string(e.Key) < "k10" {
+			t.Fatalf("expected covered key %s to be dropped", e.Key)
+		}
+	}
+	if len(st.RangeTombstones()) != 0 {
+		t.Fatalf("expected range tombstones to be dropped")
+	}
+
+	for i := 0; i < 20; i++ {
+		_, ok, _ := eng.Get([]byte(fmt.Sprintf("k%02d", i)))
+		if ok != (i >= 10) {
+			t.Fatalf("unexpected visibility for k%02d after compaction", i)
+		}
+	}
+}
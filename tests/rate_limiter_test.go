@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/ratelimit"
+)
+
+// Rate Limiter Test
+
+func TestRateLimiterThrottlesLowPriority(t *testing.T) {
+	rl := ratelimit.New(1 << 20) // 1MB/s, starting empty
+
+	start := time.Now()
+	rl.Request(200<<10, ratelimit.Low)
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected 200KB at 1MB/s to take ~200ms, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterHighPriorityDoesNotWait(t *testing.T) {
+	rl := ratelimit.New(1 << 10)
+
+	start := time.Now()
+	rl.Request(1<<20, ratelimit.High)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("expected a high-priority request not to wait, took %v", elapsed)
+	}
+
+	// a nil limiter never throttles
+	var none *ratelimit.RateLimiter
+	none.Request(1<<30, ratelimit.Low)
+}
+
+func TestRateLimiterDynamicRate(t *testing.T) {
+	rl := ratelimit.New(1 << 10)
+	rl.SetBytesPerSecond(64 << 20)
+	if rl.BytesPerSecond() != 64<<20 {
+		t.Fatalf("expected the new rate, got %d", rl.BytesPerSecond())
+	}
+
+	start := time.Now()
+	rl.Request(64<<10, ratelimit.Low)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the raised rate to apply, took %v", elapsed)
+	}
+}
+
+func TestRateLimiterAutoTune(t *testing.T) {
+	rl := ratelimit.NewAutoTuned(ratelimit.AutoTune{
+		MinBytesPerSecond: 1 << 10,
+		MaxBytesPerSecond: 1 << 20,
+		TargetLatency:     time.Millisecond,
+		Interval:          time.Nanosecond,
+	})
+	if rl.BytesPerSecond() != 1<<20 {
+		t.Fatalf("expected to start at the maximum rate, got %d", rl.BytesPerSecond())
+	}
+
+	for i := 0; i < 100; i++ {
+		rl.ReportLatency(50 * time.Millisecond)
+		time.Sleep(time.Microsecond)
+	}
+	if rl.BytesPerSecond() != 1<<10 {
+		t.Fatalf("expected slow foreground work to back off to the minimum, got %d", rl.BytesPerSecond())
+	}
+
+	for i := 0; i < 200; i++ {
+		rl.ReportLatency(0)
+		time.Sleep(time.Microsecond)
+	}
+	if rl.BytesPerSecond() != 1<<20 {
+		t.Fatalf("expected fast foreground work to restore the maximum, got %d", rl.BytesPerSecond())
+	}
+}
+
+func TestRateLimitedFlush(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.RateLimiter = ratelimit.New(512 << 10)
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	// foreground writes are charged but not delayed
+	start := time.Now()
+	_ = eng.Put([]byte("big"), bytes.Repeat([]byte("x"), 128<<10))
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected the WAL append not to wait, took %v", elapsed)
+	}
+
+	start = time.Now()
+	if err := eng.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the flush to wait for the limiter, took %v", elapsed)
+	}
+
+	if val, ok, _ := eng.Get([]byte("big")); !ok || len(val) != 128<<10 {
+		t.Fatalf("expected the flushed value back")
+	}
+}
+
+func TestThrottledFlushDoesNotBlockReads(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.RateLimiter = ratelimit.New(64 << 10)
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("big"), bytes.Repeat([]byte("x"), 32<<10))
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- eng.Flush(true) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// the table is written without the engine lock
+	start := time.Now()
+	if val, ok, _ := eng.Get([]byte("big")); !ok || len(val) != 32<<10 {
+		t.Fatalf("expected the value from the frozen memtable")
+	}
+	if err := eng.Put([]byte("small"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected reads and writes not to wait for the flush, took %v", elapsed)
+	}
+
+	select {
+	case err := <-flushed:
+		t.Fatalf("expected the flush to still be throttled, got %v", err)
+	default:
+	}
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	if val, _, _ := eng.Get([]byte("small")); string(val) != "v" {
+		t.Fatalf("expected small=v after the flush, got %q", val)
+	}
+}
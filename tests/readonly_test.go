@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Read-Only Open Test
+
+func newReadOnlyPair(t *testing.T) (*engine.Engine, *engine.Engine, config.Config) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+
+	writer, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { writer.Close() })
+
+	for i := 0; i < 20; i++ {
+		_ = writer.Put([]byte(fmt.Sprintf("k%02d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+
+	reader, err := engine.OpenReadOnly(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reader.Close() })
+
+	return writer, reader, cfg
+}
+
+func TestOpenReadOnlyReadsTablesAndWAL(t *testing.T) {
+	_, reader, cfg := newReadOnlyPair(t)
+
+	files, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(files) == 0 {
+		t.Fatalf("expected the writer to have flushed tables")
+	}
+
+	for i := 0; i < 20; i++ {
+		val, ok, err := reader.Get([]byte(fmt.Sprintf("k%02d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || string(val) != fmt.Sprintf("v%d", i) {
+			t.Fatalf("expected k%02d=v%d, got %q", i, i, val)
+		}
+	}
+}
+
+func TestOpenReadOnlyRejectsWrites(t *testing.T) {
+	_, reader, _ := newReadOnlyPair(t)
+
+	b := engine.NewBatch()
+	b.Put([]byte("a"), []byte("1"))
+
+	errs := map[string]error{
+		"Put":          reader.Put([]byte("a"), []byte("1")),
+		"Delete":       reader.Delete([]byte("a")),
+		"Write":        reader.Write(b),
+		"DeleteRange":  reader.DeleteRange([]byte("a"), []byte("b")),
+		"SingleDelete": reader.SingleDelete([]byte("a")),
+		"Compact":      reader.Compact(),
+	}
+	_, errs["CreateColumnFamily"] = reader.CreateColumnFamily("cf", config.ColumnFamilyOptions{})
+
+	for name, err := range errs {
+		if !errors.Is(err, engine.ErrReadOnly) {
+			t.Fatalf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+}
+
+func TestTryCatchUp(t *testing.T) {
+	writer, reader, _ := newReadOnlyPair(t)
+
+	_ = writer.Put([]byte("new"), []byte("1"))
+	_ = writer.Delete([]byte("k00"))
+
+	if _, ok, _ := reader.Get([]byte("new")); ok {
+		t.Fatalf("expected reader not to see new writes before TryCatchUp")
+	}
+
+	if err := reader.TryCatchUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if val, ok, _ := reader.Get([]byte("new")); !ok || string(val) != "1" {
+		t.Fatalf("expected new=1 after TryCatchUp")
+	}
+	if _, ok, _ := reader.Get([]byte("k00")); ok {
+		t.Fatalf("expected k00 deleted after TryCatchUp")
+	}
+}
+
+func TestTryCatchUpAfterCompaction(t *testing.T) {
+	writer, reader, _ := newReadOnlyPair(t)
+
+	if err := writer.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	// pinned tables stay readable
+	if val, ok, err := reader.Get([]byte("k03")); err != nil || !ok || string(val) != "v3" {
+		t.Fatalf("expected k03=v3 from pinned tables, got %q %v %v", val, ok, err)
+	}
+
+	if err := reader.TryCatchUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, ok, _ := reader.Get([]byte(fmt.Sprintf("k%02d", i))); !ok {
+			t.Fatalf("expected k%02d after catching up with compaction", i)
+		}
+	}
+}
+
+func TestTryCatchUpColumnFamilies(t *testing.T) {
+	writer, reader, _ := newReadOnlyPair(t)
+
+	cf, _ := writer.CreateColumnFamily("meta", config.ColumnFamilyOptions{})
+	_ = writer.PutCF(cf, []byte("a"), []byte("1"))
+
+	if _, ok := reader.ColumnFamily("meta"); ok {
+		t.Fatalf("expected column family to be unknown before TryCatchUp")
+	}
+
+	_ = reader.TryCatchUp()
+
+	rcf, ok := reader.ColumnFamily("meta")
+	if !ok {
+		t.Fatalf("expected column family after TryCatchUp")
+	}
+	if val, ok, _ := reader.GetCF(rcf, []byte("a")); !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 in column family")
+	}
+}
+
+func TestOpenReadOnlyIgnoresTornTail(t *testing.T) {
+	writer, _, cfg := newReadOnlyPair(t)
+	_ = writer.Put([]byte("last"), []byte("1"))
+
+	// a record the writer is still appending
+	f, err := os.OpenFile(filepath.Join(cfg.WALDir(), "wal.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 99, 0, 0})
+	f.Close()
+
+	reader, err := engine.OpenReadOnly(cfg)
+	if err != nil {
+		t.Fatalf("expected torn tail to be ignored, got %v", err)
+	}
+	defer reader.Close()
+
+	if _, ok, _ := reader.Get([]byte("last")); !ok {
+		t.Fatalf("expected last complete record to be visible")
+	}
+}
+
+func TestOpenReadOnlyMissingDatabase(t *testing.T) {
+	if _, err := engine.OpenReadOnly(config.DefaultConfig(t.TempDir())); err == nil {
+		t.Fatalf("expected error opening a missing database read-only")
+	}
+}
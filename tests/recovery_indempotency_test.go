@@ -1,6 +1,11 @@
 package tests
 
 import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"vern_kv/config"
@@ -60,3 +65,165 @@ func TestRecoveryIsIdempotent(t *testing.T) {
 		t.Fatalf("expected tombstone for a after duplicate recovery")
 	}
 }
+
+func TestRecoveryKeepsTables(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+	_ = eng1.Put([]byte("a"), []byte("1"))
+	_ = eng1.Flush(true)
+	_ = eng1.Put([]byte("b"), []byte("2"))
+	_ = eng1.Close()
+
+	before, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(before) != 1 {
+		t.Fatalf("expected 1 SSTable, got %d", len(before))
+	}
+
+	l := &recordingListener{}
+	cfg.EventListener = l
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng2.Close()
+
+	after, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(after) != 1 || after[0] != before[0] {
+		t.Fatalf("expected the SSTable to be kept, got %v", after)
+	}
+
+	// only the write above the table is replayed
+	if _, ok := eng2.MemtableGet([]byte("a")); ok {
+		t.Fatalf("expected flushed a to stay out of the memtable")
+	}
+	if _, ok := eng2.MemtableGet([]byte("b")); !ok {
+		t.Fatalf("expected b to be replayed into the memtable")
+	}
+	if val, _, _ := eng2.Get([]byte("a")); string(val) != "1" {
+		t.Fatalf("expected a=1 from the table, got %q", val)
+	}
+	if eng2.Sequence() != 2 {
+		t.Fatalf("expected seq=2, got %d", eng2.Sequence())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, ev := range l.events {
+		if strings.HasPrefix(ev, "deleted") {
+			t.Fatalf("expected no table deletions at Open, got %v", l.events)
+		}
+	}
+}
+
+func TestRecoveryDropsInterruptedCompactionInputs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+	_ = eng1.Put([]byte("a"), []byte("1"))
+	_ = eng1.Put([]byte("b"), []byte("2"))
+	_ = eng1.Flush(true)
+	_ = eng1.Delete([]byte("a"))
+	_ = eng1.Flush(true)
+
+	// keep the oldest input, as if the compaction crashed before deleting it
+	inputs, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	data, err := os.ReadFile(inputs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = eng1.Compact()
+	_ = eng1.Close()
+	_ = os.WriteFile(inputs[0], data, 0644)
+
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng2.Close()
+
+	if _, ok, _ := eng2.Get([]byte("a")); ok {
+		t.Fatalf("expected a to stay deleted")
+	}
+	if val, _, _ := eng2.Get([]byte("b")); string(val) != "2" {
+		t.Fatalf("expected b=2, got %q", val)
+	}
+	if _, err := os.Stat(inputs[0]); !os.IsNotExist(err) {
+		t.Fatalf("expected the leftover input to be deleted")
+	}
+}
+
+// writes a table in the original TKV1 format, which records no min-seq:
+// key i of keys gets sequence number firstSeq+i.
+func writeV1Table(t *testing.T, path string, keys []string, firstSeq uint64) {
+	t.Helper()
+	var data, index []byte
+	for i, k := range keys {
+		index = binary.BigEndian.AppendUint32(index, uint32(len(k)))
+		index = append(index, k...)
+		index = binary.BigEndian.AppendUint64(index, uint64(len(data)))
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(k)))
+		data = binary.BigEndian.AppendUint32(data, uint32(len("v"+k)))
+		data = binary.BigEndian.AppendUint64(data, firstSeq+uint64(i))
+		data = append(data, 0)
+		data = append(data, k...)
+		data = append(data, "v"+k...)
+	}
+
+	footer := binary.BigEndian.AppendUint64(nil, uint64(len(data)))
+	footer = binary.BigEndian.AppendUint64(footer, uint64(len(keys)))
+	footer = binary.BigEndian.AppendUint64(footer, firstSeq+uint64(len(keys))-1)
+	footer = binary.BigEndian.AppendUint32(footer, 0x544B5631) // "TKV1"
+
+	if err := os.WriteFile(path, append(append(data, index...), footer...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoveryKeepsTablesWithoutMinSeq(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+	if err := os.MkdirAll(cfg.SSTableDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// two flushes of a database written before min-seqs were recorded
+	var keys []string
+	for i := range 100 {
+		keys = append(keys, fmt.Sprintf("k%03d", i))
+	}
+	writeV1Table(t, filepath.Join(cfg.SSTableDir(), "sst_1.sst"), keys[:60], 1)
+	writeV1Table(t, filepath.Join(cfg.SSTableDir(), "sst_2.sst"), keys[60:], 61)
+
+	for run := range 2 {
+		eng, err := engine.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			if v, ok, err := eng.Get([]byte(k)); err != nil || !ok || string(v) != "v"+k {
+				t.Fatalf("run %d: expected %s=v%s, got %q %v %v", run, k, k, v, ok, err)
+			}
+		}
+		if n := intProperty(t, eng, engine.PropNumSSTables); n != 2 {
+			t.Fatalf("run %d: expected both tables kept, got %d", run, n)
+		}
+		if err := eng.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ro, err := engine.OpenReadOnly(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	for _, k := range keys {
+		if _, ok, err := ro.Get([]byte(k)); err != nil || !ok {
+			t.Fatalf("read-only: expected %s, got %v %v", k, ok, err)
+		}
+	}
+}
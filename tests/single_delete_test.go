@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/memtable"
+	"vern_kv/sstable"
+)
+
+// Single Delete Test
+
+func TestSingleDeleteHidesKey(t *testing.T) {
+	dir := t.TempDir()
+
+	eng, _ := engine.Open(config.DefaultConfig(dir))
+	_ = eng.Put([]byte("idx/1"), []byte("v"))
+	if err := eng.SingleDelete([]byte("idx/1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := eng.Get([]byte("idx/1")); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+	_ = eng.Close()
+
+	eng, _ = engine.Open(config.DefaultConfig(dir))
+	defer eng.Close()
+
+	if _, ok, _ := eng.Get([]byte("idx/1")); ok {
+		t.Fatalf("expected key to stay deleted after restart")
+	}
+}
+
+func TestSingleDeleteVanishesInMemtable(t *testing.T) {
+	mt := memtable.New()
+	mt.Put([]byte("a"), []byte("1"), 1)
+	mt.Put([]byte("b"), []byte("2"), 2)
+
+	if misuse := mt.SingleDelete([]byte("a"), 3); misuse {
+		t.Fatalf("unexpected misuse")
+	}
+
+	if _, ok := mt.Get([]byte("a")); ok {
+		t.Fatalf("expected put and single delete to vanish together")
+	}
+	if n := len(mt.AllEntriesSorted()); n != 1 {
+		t.Fatalf("expected 1 entry, got %d", n)
+	}
+}
+
+func TestSingleDeleteOverTableValue(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	for i := 0; i < 20; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("k%02d", i)), []byte("value"))
+	}
+
+	// the values live in tables; the tombstones must hide them
+	for i := 0; i < 10; i++ {
+		_ = eng.SingleDelete([]byte(fmt.Sprintf("k%02d", i)))
+	}
+	for i := 0; i < 20; i++ {
+		_, ok, _ := eng.Get([]byte(fmt.Sprintf("k%02d", i)))
+		if ok != (i >= 10) {
+			t.Fatalf("unexpected visibility for k%02d", i)
+		}
+	}
+
+	// flush the single deletes
+	for i := 0; i < 10; i++ {
+		_ = eng.Put([]byte(fmt.Sprintf("z%02d", i)), []byte("value"))
+	}
+
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	for _, f := range files {
+		st, err := sstable.Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all, _ := st.ScanPrefix(nil)
+		st.Close()
+		for _, e := range all {
+			if e.Tombstone || string(e.Key) < "k10" {
+				t.Fatalf("expected single delete and value to vanish, found %s", e.Key)
+			}
+		}
+	}
+}
+
+func TestSingleDeletePersistedInSSTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "single.sst")
+
+	entries := []sstable.Entry{
+		{Key: []byte("a"), Seq: 2, Tombstone: true, SingleDelete: true},
+		{Key: []byte("b"), Seq: 3, Tombstone: true},
+	}
+	if err := sstable.Write(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	st, _ := sstable.Open(path)
+	defer st.Close()
+
+	a, _, _ := st.Get([]byte("a"))
+	b, _, _ := st.Get([]byte("b"))
+	if !a.Tombstone || !a.SingleDelete {
+		t.Fatalf("expected single delete record, got %+v", a)
+	}
+	if !b.Tombstone || b.SingleDelete {
+		t.Fatalf("expected plain tombstone, got %+v", b)
+	}
+}
+
+func TestSingleDeleteMisuseDebug(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Debug = true
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("once"), []byte("1"))
+	if err := eng.SingleDelete([]byte("once")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	_ = eng.Put([]byte("twice"), []byte("1"))
+	_ = eng.Put([]byte("twice"), []byte("2"))
+	if err := eng.SingleDelete([]byte("twice")); !errors.Is(err, engine.ErrSingleDeleteMisuse) {
+		t.Fatalf("expected ErrSingleDeleteMisuse, got %v", err)
+	}
+
+	// the delete is still applied
+	if _, ok, _ := eng.Get([]byte("twice")); ok {
+		t.Fatalf("expected key to be deleted")
+	}
+}
+
+func TestSingleDeleteMisuseDetectedOnCompact(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 8
+	cfg.Debug = true
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	// each write fills a memtable, so every version lands in its own table
+	_ = eng.Put([]byte("key"), []byte("first-value"))
+	_ = eng.Put([]byte("key"), []byte("second-value"))
+	_ = eng.SingleDelete([]byte("key"))
+	_ = eng.Put([]byte("pad"), []byte("padding-value"))
+
+	if err := eng.Compact(); !errors.Is(err, engine.ErrSingleDeleteMisuse) {
+		t.Fatalf("expected ErrSingleDeleteMisuse from Compact, got %v", err)
+	}
+}
+
+func TestSingleDeleteMisuseIgnoredWithoutDebug(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("k"), []byte("1"))
+	_ = eng.Put([]byte("k"), []byte("2"))
+	if err := eng.SingleDelete([]byte("k")); err != nil {
+		t.Fatalf("expected no error outside debug mode, got %v", err)
+	}
+}
+
+func TestSingleDeleteKeepsTombstoneOverFlushedVersion(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		cfg := config.DefaultConfig(t.TempDir())
+		cfg.Debug = debug
+
+		eng, _ := engine.Open(cfg)
+
+		_ = eng.Put([]byte("k"), []byte("v1"))
+		_ = eng.Flush(true)
+		_ = eng.Put([]byte("k"), []byte("v2"))
+
+		err := eng.SingleDelete([]byte("k"))
+		if debug && !errors.Is(err, engine.ErrSingleDeleteMisuse) {
+			t.Fatalf("expected ErrSingleDeleteMisuse in debug mode, got %v", err)
+		}
+		if !debug && err != nil {
+			t.Fatalf("expected no error outside debug mode, got %v", err)
+		}
+
+		if val, ok, _ := eng.Get([]byte("k")); ok {
+			t.Fatalf("expected k to stay deleted (debug=%v), got %s", debug, val)
+		}
+		_ = eng.Close()
+	}
+}
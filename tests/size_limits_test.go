@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/sstable"
+)
+
+// Size Limits Test
+
+func newLimitedConfig(t *testing.T) config.Config {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MaxKeySize = 8
+	cfg.MaxValueSize = 16
+	return cfg
+}
+
+func TestWriteSizeLimits(t *testing.T) {
+	eng, _ := engine.Open(newLimitedConfig(t))
+	defer eng.Close()
+
+	longKey := []byte("key-too-long")
+	longValue := bytes.Repeat([]byte("v"), 17)
+
+	if err := eng.Put(longKey, []byte("v")); !errors.Is(err, engine.ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+	}
+	if err := eng.Put([]byte("k"), longValue); !errors.Is(err, engine.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	if err := eng.Delete(longKey); !errors.Is(err, engine.ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge from Delete, got %v", err)
+	}
+	if err := eng.DeleteRange([]byte("a"), longKey); !errors.Is(err, engine.ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge from DeleteRange, got %v", err)
+	}
+
+	// exactly at the limits
+	if err := eng.Put([]byte("12345678"), bytes.Repeat([]byte("v"), 16)); err != nil {
+		t.Fatalf("expected write at the limits to succeed, got %v", err)
+	}
+}
+
+func TestBatchSizeLimitsAreAtomic(t *testing.T) {
+	eng, _ := engine.Open(newLimitedConfig(t))
+	defer eng.Close()
+
+	b := engine.NewBatch()
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), bytes.Repeat([]byte("v"), 17))
+
+	if err := eng.Write(b); !errors.Is(err, engine.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	if _, ok, _ := eng.Get([]byte("a")); ok {
+		t.Fatalf("expected no write of a refused batch to apply")
+	}
+}
+
+func TestEmptyKeyRejected(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	b := engine.NewBatch()
+	b.Put(nil, []byte("1"))
+
+	errs := map[string]error{
+		"Put":          eng.Put(nil, []byte("1")),
+		"Put empty":    eng.Put([]byte{}, []byte("1")),
+		"Delete":       eng.Delete(nil),
+		"SingleDelete": eng.SingleDelete(nil),
+		"Write":        eng.Write(b),
+	}
+	for name, err := range errs {
+		if !errors.Is(err, engine.ErrEmptyKey) {
+			t.Fatalf("%s: expected ErrEmptyKey, got %v", name, err)
+		}
+	}
+
+	// an empty start bound deletes from the first key
+	_ = eng.Put([]byte("a"), []byte("1"))
+	if err := eng.DeleteRange(nil, []byte("b")); err != nil {
+		t.Fatalf("expected empty range start to be accepted, got %v", err)
+	}
+	if _, ok, _ := eng.Get([]byte("a")); ok {
+		t.Fatalf("expected a to be deleted")
+	}
+}
+
+func TestDefaultSizeLimits(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	if cfg.KeySizeLimit() != config.DefaultMaxKeySize || cfg.ValueSizeLimit() != config.DefaultMaxValueSize {
+		t.Fatalf("unexpected default limits %d/%d", cfg.KeySizeLimit(), cfg.ValueSizeLimit())
+	}
+}
+
+func TestSSTableSizeLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.sst")
+	entries := []sstable.Entry{{Key: []byte("key"), Value: bytes.Repeat([]byte("v"), 32), Seq: 1}}
+
+	err := sstable.WriteWithOptions(path, entries, sstable.WriteOptions{MaxValueSize: 16})
+	if !errors.Is(err, engine.ErrValueTooLarge) {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+
+	if err := sstable.Write(path, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reader with a lower key limit refuses the index
+	if _, err := sstable.OpenWithOptions(path, sstable.ReadOptions{MaxKeySize: 2}); !errors.Is(err, engine.ErrCorruption) {
+		t.Fatalf("expected ErrCorruption for an oversized index key, got %v", err)
+	}
+
+	// and a lower value limit refuses the entry
+	st, err := sstable.OpenWithOptions(path, sstable.ReadOptions{MaxValueSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if _, _, err := st.Get([]byte("key")); !errors.Is(err, engine.ErrCorruption) {
+		t.Fatalf("expected ErrCorruption for an oversized value, got %v", err)
+	}
+}
+
+func TestWALReplayRefusesOversizedRecords(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+
+	eng, _ := engine.Open(cfg)
+	_ = eng.Put([]byte("k"), bytes.Repeat([]byte("v"), 32))
+	_ = eng.Close()
+
+	cfg.MaxValueSize = 16
+	if _, err := engine.Open(cfg); !errors.Is(err, engine.ErrCorruption) {
+		t.Fatalf("expected ErrCorruption replaying an oversized value, got %v", err)
+	}
+}
+
+func TestReopenWithSmallKeyLimit(t *testing.T) {
+	cfg := newLimitedConfig(t)
+
+	eng, _ := engine.Open(cfg)
+	// metadata records are longer than the key limit
+	_, _ = eng.CreateColumnFamily("a-long-column-family", config.ColumnFamilyOptions{})
+	txn := eng.BeginTwoPhase("a-long-transaction")
+	_ = txn.Put([]byte("k"), []byte("v"))
+	_ = txn.Prepare()
+	_ = txn.Commit()
+	_ = eng.Close()
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatalf("expected reopen with MaxKeySize 8 to succeed, got %v", err)
+	}
+	defer eng.Close()
+
+	if _, ok := eng.ColumnFamily("a-long-column-family"); !ok {
+		t.Fatalf("expected the column family after reopen")
+	}
+	if val, _, _ := eng.Get([]byte("k")); string(val) != "v" {
+		t.Fatalf("expected k=v after reopen, got %q", val)
+	}
+}
+
+func TestMergedValueBeyondValueLimitFlushes(t *testing.T) {
+	cfg := newLimitedConfig(t)
+	cfg.MergeOperator = appendOp{}
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	want := ""
+	for i := 0; i < 8; i++ {
+		op := bytes.Repeat([]byte{byte('a' + i)}, 16)
+		if err := eng.Merge([]byte("k"), op); err != nil {
+			t.Fatalf("merge %d: %v", i, err)
+		}
+		if want != "" {
+			want += ","
+		}
+		want += string(op)
+	}
+	if err := eng.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	_ = eng.Close()
+
+	eng, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+
+	if val, _, err := eng.Get([]byte("k")); err != nil || string(val) != want {
+		t.Fatalf("expected the folded value, got %q, %v", val, err)
+	}
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/stats"
+)
+
+// Statistics Test
+
+func TestStatsCountEngineWork(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Statistics = true
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+	_ = eng.Put([]byte("b"), []byte("22"))
+	_ = eng.Delete([]byte("a"))
+	_ = eng.Flush(true)
+	_, _, _ = eng.Get([]byte("b"))
+
+	st := eng.Stats()
+	want := map[stats.Ticker]uint64{
+		stats.KeysWritten:   3,
+		stats.BytesWritten:  6,
+		stats.KeysRead:      1,
+		stats.Flushes:       1,
+		stats.SSTableOpens:  1,
+		stats.SSTableProbes: 1,
+	}
+	for ticker, n := range want {
+		if got := st.Ticker(ticker); got != n {
+			t.Fatalf("%s: expected %d, got %d", ticker, n, got)
+		}
+	}
+	if st.Ticker(stats.WALBytes) == 0 || st.Ticker(stats.WALSyncs) < 3 {
+		t.Fatalf("expected WAL bytes and syncs to be counted")
+	}
+
+	if h := st.Histogram(stats.PutLatency); h.Count != 2 {
+		t.Fatalf("expected 2 timed puts, got %d", h.Count)
+	}
+	if h := st.Histogram(stats.FlushLatency); h.Count != 1 {
+		t.Fatalf("expected 1 timed flush, got %d", h.Count)
+	}
+	h := st.Histogram(stats.GetLatency)
+	if h.Count != 1 || h.Buckets[len(h.Buckets)-1].Count > h.Count {
+		t.Fatalf("expected 1 timed get with cumulative buckets, got %+v", h)
+	}
+}
+
+func TestStatsDisabledByDefault(t *testing.T) {
+	eng, _ := engine.Open(config.DefaultConfig(t.TempDir()))
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+
+	if st := eng.Stats(); st != nil || st.Ticker(stats.KeysWritten) != 0 {
+		t.Fatalf("expected nil statistics when disabled")
+	}
+}
+
+func TestStatsPrometheusHandler(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Statistics = true
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.Put([]byte("a"), []byte("1"))
+
+	rec := httptest.NewRecorder()
+	eng.Stats().Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	for _, line := range []string{
+		"# TYPE vern_keys_written_total counter",
+		"vern_keys_written_total 1",
+		"# TYPE vern_put_latency_seconds histogram",
+		`vern_put_latency_seconds_bucket{le="+Inf"} 1`,
+		"vern_put_latency_seconds_count 1",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("expected %q in exposition:\n%s", line, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+}
+
+func TestStatsHistogramSnapshotIsConsistent(t *testing.T) {
+	st := stats.New()
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				st.Observe(stats.GetLatency, time.Nanosecond)
+			}
+		}
+	}()
+
+	for i := 0; i < 10000; i++ {
+		h := st.Histogram(stats.GetLatency)
+		if last := h.Buckets[len(h.Buckets)-1].Count; h.Count < last {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("count %d below the last bucket %d", h.Count, last)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
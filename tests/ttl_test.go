@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/sstable"
+)
+
+// TTL Test
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTTLConfig(t *testing.T) (config.Config, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Clock = clock.Now
+	return cfg, clock
+}
+
+func TestPutWithTTLExpiresOnRead(t *testing.T) {
+	cfg, clock := newTTLConfig(t)
+
+	eng, _ := engine.Open(cfg)
+
+	if err := eng.PutWithTTL([]byte("session"), []byte("s1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	_ = eng.Put([]byte("session/other"), []byte("keep"))
+
+	val, ok, _ := eng.Get([]byte("session"))
+	if !ok || string(val) != "s1" {
+		t.Fatalf("expected session to be visible before expiry")
+	}
+
+	clock.Advance(time.Minute)
+
+	if _, ok, _ := eng.Get([]byte("session")); ok {
+		t.Fatalf("expected session to expire")
+	}
+
+	count := 0
+	_ = eng.ScanPrefix([]byte("session"), func(k, v []byte) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Fatalf("expected scan to skip expired key, got %d keys", count)
+	}
+	_ = eng.Close()
+
+	// expiry must survive WAL replay
+	eng2, _ := engine.Open(cfg)
+	defer eng2.Close()
+
+	if _, ok, _ := eng2.Get([]byte("session")); ok {
+		t.Fatalf("expected session to stay expired after recovery")
+	}
+}
+
+func TestPutWithTTLRejectsNonPositive(t *testing.T) {
+	cfg, _ := newTTLConfig(t)
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	if err := eng.PutWithTTL([]byte("k"), []byte("v"), 0); err != engine.ErrInvalidTTL {
+		t.Fatalf("expected ErrInvalidTTL, got %v", err)
+	}
+}
+
+func TestExpiredValueDroppedOnFlush(t *testing.T) {
+	cfg, clock := newTTLConfig(t)
+	cfg.MemtableSizeBytes = 64
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	// older version lands in SSTable 1
+	_ = eng.Put([]byte("k"), make([]byte, 64))
+
+	_ = eng.PutWithTTL([]byte("k"), []byte("short-lived"), time.Second)
+	clock.Advance(time.Second)
+	_ = eng.Put([]byte("filler"), make([]byte, 64)) // flush → SSTable 2
+
+	files, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(files) != 2 {
+		t.Fatalf("expected 2 SSTables, got %d", len(files))
+	}
+
+	var sawTombstone bool
+	for _, f := range files {
+		st, err := sstable.Open(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, ok, _ := st.Get([]byte("k"))
+		st.Close()
+		if ok && string(e.Value) == "short-lived" {
+			t.Fatalf("expected expired value to be dropped on flush")
+		}
+		if ok && e.Tombstone {
+			sawTombstone = true
+		}
+	}
+	if !sawTombstone {
+		t.Fatalf("expected expired value to be replaced by a tombstone")
+	}
+
+	if _, ok, _ := eng.Get([]byte("k")); ok {
+		t.Fatalf("expected older version to stay hidden")
+	}
+}
+
+func TestExpiredValueDroppedOnCompact(t *testing.T) {
+	cfg, clock := newTTLConfig(t)
+	cfg.MemtableSizeBytes = 1
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	_ = eng.PutWithTTL([]byte("a"), []byte("1"), time.Second) // SSTable 1
+	_ = eng.Put([]byte("b"), []byte("2"))                     // SSTable 2
+
+	clock.Advance(time.Second)
+	if err := eng.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(cfg.SSTableDir(), "*.sst"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 SSTable after compaction, got %d", len(files))
+	}
+
+	st, _ := sstable.Open(files[0])
+	defer st.Close()
+
+	if _, ok, _ := st.Get([]byte("a")); ok {
+		t.Fatalf("expected expired key to be dropped by compaction")
+	}
+	if _, ok, _ := st.Get([]byte("b")); !ok {
+		t.Fatalf("expected live key to survive compaction")
+	}
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+)
+
+// Two-Phase Commit Test
+func TestTwoPhasePreparedSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn := eng1.BeginTwoPhase("xa-1")
+	_ = txn.Put([]byte("a"), []byte("1"))
+	_ = txn.Delete([]byte("b"))
+	if err := txn.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, _ := eng1.Get([]byte("a")); ok {
+		t.Fatalf("expected prepared write to be invisible")
+	}
+	_ = eng1.Put([]byte("c"), []byte("3"))
+
+	// Simulate crash before the coordinator decides
+	_ = eng1.Close()
+
+	eng2, err := engine.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := eng2.PreparedTxns()
+	if len(names) != 1 || names[0] != "xa-1" {
+		t.Fatalf("expected [xa-1] prepared after restart, got %v", names)
+	}
+	if err := eng2.CommitPrepared("xa-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	val, ok, _ := eng2.Get([]byte("a"))
+	if !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 after commit")
+	}
+	if eng2.Sequence() != 3 {
+		t.Fatalf("expected seq=3, got %d", eng2.Sequence())
+	}
+	_ = eng2.Close()
+
+	// Commit decision must also be durable
+	eng3, _ := engine.Open(cfg)
+	defer eng3.Close()
+
+	if len(eng3.PreparedTxns()) != 0 {
+		t.Fatalf("expected no prepared txns after commit")
+	}
+	val, ok, _ = eng3.Get([]byte("a"))
+	if !ok || string(val) != "1" {
+		t.Fatalf("expected a=1 after recovery")
+	}
+}
+
+func TestTwoPhaseRollback(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig(dir)
+
+	eng1, _ := engine.Open(cfg)
+
+	txn := eng1.BeginTwoPhase("xa-2")
+	_ = txn.Put([]byte("a"), []byte("1"))
+	_ = txn.Prepare()
+
+	dup := eng1.BeginTwoPhase("xa-2")
+	if err := dup.Prepare(); !errors.Is(err, engine.ErrTxnExists) {
+		t.Fatalf("expected ErrTxnExists, got %v", err)
+	}
+
+	if err := txn.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	_ = eng1.Close()
+
+	eng2, _ := engine.Open(cfg)
+	defer eng2.Close()
+
+	if len(eng2.PreparedTxns()) != 0 {
+		t.Fatalf("expected rollback to be durable")
+	}
+	if _, ok, _ := eng2.Get([]byte("a")); ok {
+		t.Fatalf("expected rolled back write to be discarded")
+	}
+	if err := eng2.CommitPrepared("xa-2"); !errors.Is(err, engine.ErrUnknownTxn) {
+		t.Fatalf("expected ErrUnknownTxn, got %v", err)
+	}
+}
+
+func TestTwoPhaseCommitRequiresPrepare(t *testing.T) {
+	dir := t.TempDir()
+	eng, _ := engine.Open(config.DefaultConfig(dir))
+	defer eng.Close()
+
+	txn := eng.BeginTwoPhase("xa-3")
+	_ = txn.Put([]byte("a"), []byte("1"))
+	if err := txn.Commit(); !errors.Is(err, engine.ErrNotPrepared) {
+		t.Fatalf("expected ErrNotPrepared, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"vern_kv/config"
+	"vern_kv/engine"
+	"vern_kv/stats"
+)
+
+// Write Stall Test
+
+// stallListener records write stall transitions.
+type stallListener struct {
+	config.NoopEventListener
+
+	mu     sync.Mutex
+	stalls []config.WriteStallInfo
+}
+
+func (l *stallListener) OnWriteStall(info config.WriteStallInfo) {
+	l.mu.Lock()
+	l.stalls = append(l.stalls, info)
+	l.mu.Unlock()
+}
+
+// writes and flushes one table per key.
+func flushTables(t *testing.T, eng *engine.Engine, keys ...string) {
+	t.Helper()
+	for _, k := range keys {
+		if err := eng.PutWithOptions([]byte(k), []byte("v"), engine.WriteOptions{NoSlowdown: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := eng.Flush(true); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteStallStopRelievedByBackgroundCompaction(t *testing.T) {
+	l := &stallListener{}
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Statistics = true
+	cfg.EventListener = l
+	cfg.WriteStall = config.WriteStallOptions{StopL0Tables: 2}
+
+	eng, _ := engine.Open(cfg)
+	flushTables(t, eng, "a", "b")
+
+	// refused, but starts the compaction relieving the stop
+	err := eng.PutWithOptions([]byte("c"), []byte("3"), engine.WriteOptions{NoSlowdown: true})
+	if !errors.Is(err, engine.ErrWouldStall) {
+		t.Fatalf("expected ErrWouldStall, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := eng.PutCtx(ctx, []byte("c"), []byte("3")); err != nil {
+		t.Fatalf("expected the background compaction to release PutCtx, got %v", err)
+	}
+
+	if n := intProperty(t, eng, engine.PropNumSSTables); n != 1 {
+		t.Fatalf("expected the tables compacted into 1, got %d", n)
+	}
+	if n := eng.Stats().Ticker(stats.Compactions); n != 1 {
+		t.Fatalf("expected 1 compaction, got %d", n)
+	}
+	_ = eng.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.stalls) != 2 || l.stalls[0].Cur != config.WriteStallStopped || l.stalls[1].Cur != config.WriteStallNormal {
+		t.Fatalf("expected stopped then normal events, got %+v", l.stalls)
+	}
+}
+
+func TestWriteStallStopAtOneTableIsRelieved(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.WriteStall = config.WriteStallOptions{StopL0Tables: 1}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	// a single table cannot be compacted into fewer, so it must not stop
+	flushTables(t, eng, "a")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := eng.PutCtx(ctx, []byte("b"), []byte("2")); err != nil {
+		t.Fatalf("expected a write after one table, got %v", err)
+	}
+
+	if err := eng.Flush(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.PutCtx(ctx, []byte("c"), []byte("3")); err != nil {
+		t.Fatalf("expected the compaction of two tables to release PutCtx, got %v", err)
+	}
+	if n := intProperty(t, eng, engine.PropNumSSTables); n != 1 {
+		t.Fatalf("expected the tables compacted into 1, got %d", n)
+	}
+}
+
+func TestWriteStallPlainPutsDoNotHang(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.MemtableSizeBytes = 64
+	cfg.WriteStall = config.WriteStallOptions{
+		SlowdownImmutableMemtables: 1,
+		StopImmutableMemtables:     2,
+		SlowdownL0Tables:           2,
+		StopL0Tables:               3,
+		MaxDelay:                   time.Millisecond,
+	}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	const n = 100
+	done := make(chan error)
+	go func() {
+		for i := range n {
+			if err := eng.Put([]byte(fmt.Sprintf("k%03d", i)), []byte("value")); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the stalled Puts to be relieved")
+	}
+
+	for i := range n {
+		if _, ok, _ := eng.Get([]byte(fmt.Sprintf("k%03d", i))); !ok {
+			t.Fatalf("expected k%03d", i)
+		}
+	}
+}
+
+func TestWriteStallDelaysProportionally(t *testing.T) {
+	cfg := config.DefaultConfig(t.TempDir())
+	cfg.Statistics = true
+	cfg.WriteStall = config.WriteStallOptions{
+		SlowdownL0Tables: 1,
+		StopL0Tables:     3,
+		MaxDelay:         300 * time.Millisecond,
+	}
+
+	eng, _ := engine.Open(cfg)
+	defer eng.Close()
+
+	flushTables(t, eng, "a")
+
+	// one table of the three that stop writes: a third of MaxDelay
+	start := time.Now()
+	if err := eng.Put([]byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > 250*time.Millisecond {
+		t.Fatalf("expected a ~100ms delay, took %v", elapsed)
+	}
+
+	if n := eng.Stats().Ticker(stats.WriteStallDelays); n != 1 {
+		t.Fatalf("expected 1 delayed write, got %d", n)
+	}
+	if eng.Stats().Ticker(stats.WriteStallMicros) < 80_000 {
+		t.Fatalf("expected the stall time to be counted")
+	}
+}
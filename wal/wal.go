@@ -2,31 +2,104 @@ package wal
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+
+	"vern_kv/errs"
+	"vern_kv/ratelimit"
+	"vern_kv/stats"
 )
 
 const (
 	recordPut    byte = 1
 	recordDelete byte = 2
+	recordBatch  byte = 3
+
+	// two-phase commit: PREPARE holds a named batch, COMMIT assigns its
+	// sequence numbers, ROLLBACK discards it
+	recordPrepare  byte = 4
+	recordCommit   byte = 5
+	recordRollback byte = 6
+
+	// a merge operand for the configured merge operator
+	recordMerge byte = 7
+
+	// a PUT whose value is prefixed by an 8-byte expiry (unix nanoseconds)
+	recordPutTTL byte = 8
+
+	// column family lifecycle: key holds the name, value the 4-byte id
+	// (followed, when creating, by the options recorded for it)
+	recordCreateCF byte = 9
+	recordDropCF   byte = 10
+
+	// the comparator name the database was created with (key holds the name)
+	recordComparator byte = 11
+
+	// deletes every key in [key, value)
+	recordRangeDelete byte = 12
+
+	// a tombstone for a key written exactly once
+	recordSingleDelete byte = 13
 )
 
+// seq, keyLen, valLen, type
+const recordHeaderSize = 8 + 4 + 4 + 1
+
 // WAL (Write-Ahead Log)
 type WAL struct {
 	file *os.File
+	path string
+
+	opts Options
+}
+
+// Options configures a WAL.
+type Options struct {
+	// appends fail and Recover stops quietly at an incomplete trailing
+	// record; the WAL must exist
+	ReadOnly bool
+
+	// Recover refuses records with longer keys or values as corruption
+	// (0 = no limit)
+	MaxKeySize   int
+	MaxValueSize int
+
+	// counts appended bytes and fsyncs (nil disables)
+	Stats *stats.Stats
+
+	// appends are charged to it at high priority (nil disables)
+	RateLimiter *ratelimit.RateLimiter
 }
 
 // opens (or creates) a WAL file in append mode.
 func Open(dir string) (*WAL, error) {
+	return OpenWithOptions(dir, Options{})
+}
+
+// opens an existing WAL file for reading only, alongside a writer.
+func OpenReadOnly(dir string) (*WAL, error) {
+	return OpenWithOptions(dir, Options{ReadOnly: true})
+}
+
+// opens a WAL file with options.
+func OpenWithOptions(dir string, opts Options) (*WAL, error) {
 	path := filepath.Join(dir, "wal.log")
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	var f *os.File
+	var err error
+	if opts.ReadOnly {
+		f, err = os.Open(path)
+	} else {
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &WAL{file: f}, nil
+	return &WAL{file: f, path: path, opts: opts}, nil
 }
 
 // appends a PUT record to the WAL.
@@ -34,12 +107,238 @@ func (w *WAL) AppendPut(seq uint64, key, value []byte) error {
 	return w.appendRecord(seq, recordPut, key, value)
 }
 
+// appends a PUT record that expires at expiresAt (unix nanoseconds).
+func (w *WAL) AppendPutTTL(seq uint64, key, value []byte, expiresAt int64) error {
+	return w.appendRecord(seq, recordPutTTL, key, ttlValue(expiresAt, value))
+}
+
+// prefixes value with its expiry.
+func ttlValue(expiresAt int64, value []byte) []byte {
+	buf := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(expiresAt))
+	copy(buf[8:], value)
+	return buf
+}
+
+// builds an Entry from a decoded record type and payload.
+func decodeEntry(seq uint64, typ byte, key, value []byte) (Entry, error) {
+	switch typ {
+	case recordPut, recordDelete, recordMerge, recordPutTTL, recordRangeDelete, recordSingleDelete:
+	default:
+		return Entry{}, fmt.Errorf("wal: unknown record type %d", typ)
+	}
+
+	e := Entry{
+		Seq:         seq,
+		Key:         key,
+		Value:       value,
+		Tombstone:   typ == recordDelete || typ == recordSingleDelete,
+		Merge:       typ == recordMerge,
+		RangeDelete: typ == recordRangeDelete,
+
+		SingleDelete: typ == recordSingleDelete,
+	}
+
+	if typ == recordPutTTL {
+		if len(value) < 8 {
+			return Entry{}, fmt.Errorf("wal: truncated ttl record")
+		}
+		e.ExpiresAt = int64(binary.BigEndian.Uint64(value))
+		e.Value = value[8:]
+	}
+
+	return e, nil
+}
+
 // appends a DELETE (tombstone) record.
 func (w *WAL) AppendDelete(seq uint64, key []byte) error {
 	return w.appendRecord(seq, recordDelete, key, nil)
 }
 
+// appends a range tombstone deleting every key in [start, end).
+func (w *WAL) AppendRangeDelete(seq uint64, start, end []byte) error {
+	return w.appendRecord(seq, recordRangeDelete, start, end)
+}
+
+// appends a SINGLE DELETE record.
+func (w *WAL) AppendSingleDelete(seq uint64, key []byte) error {
+	return w.appendRecord(seq, recordSingleDelete, key, nil)
+}
+
+// appends a MERGE operand record.
+func (w *WAL) AppendMerge(seq uint64, key, operand []byte) error {
+	return w.appendRecord(seq, recordMerge, key, operand)
+}
+
+// appends a BATCH record holding entries with sequences seq, seq+1, ...
+// The whole batch is a single record written with one fsync, so replay
+// sees either all of its entries or none of them.
+func (w *WAL) AppendBatch(seq uint64, entries []Entry) error {
+	return w.appendRecord(seq, recordBatch, nil, encodeBatch(entries))
+}
+
+// appends a PREPARE record holding the named transaction's writes.
+// Prepared writes get no sequence numbers until committed.
+func (w *WAL) AppendPrepare(name string, entries []Entry) error {
+	return w.appendRecord(0, recordPrepare, []byte(name), encodeBatch(entries))
+}
+
+// appends a COMMIT record for a prepared transaction whose writes take
+// sequences seq, seq+1, ...
+func (w *WAL) AppendCommitPrepared(seq uint64, name string) error {
+	return w.appendRecord(seq, recordCommit, []byte(name), nil)
+}
+
+// appends a ROLLBACK record for a prepared transaction.
+func (w *WAL) AppendRollbackPrepared(name string) error {
+	return w.appendRecord(0, recordRollback, []byte(name), nil)
+}
+
+// ColumnFamilyOptions are the options recorded with a column family.
+type ColumnFamilyOptions struct {
+	MemtableSizeBytes int64
+
+	// name of the merge operator ("" for none)
+	MergeOperator string
+}
+
+// appends a record creating column family id with name and opts.
+func (w *WAL) AppendCreateColumnFamily(id uint32, name string, opts ColumnFamilyOptions) error {
+	value := binary.BigEndian.AppendUint64(cfValue(id), uint64(opts.MemtableSizeBytes))
+	value = append(value, opts.MergeOperator...)
+	return w.appendRecord(0, recordCreateCF, []byte(name), value)
+}
+
+// appends a record dropping column family id.
+func (w *WAL) AppendDropColumnFamily(id uint32, name string) error {
+	return w.appendRecord(0, recordDropCF, []byte(name), cfValue(id))
+}
+
+// appends a record naming the database comparator.
+func (w *WAL) AppendComparator(name string) error {
+	return w.appendRecord(0, recordComparator, []byte(name), nil)
+}
+
+// Size returns the WAL size in bytes.
+func (w *WAL) Size() (int64, error) {
+	stat, err := w.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
+
+func cfValue(id uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, id)
+	return buf
+}
+
+// encodes batch entries as: count, then (type, cf, keyLen, valLen, key, value).
+func encodeBatch(entries []Entry) []byte {
+	values := make([][]byte, len(entries))
+	size := 4
+	for i, e := range entries {
+		values[i] = e.Value
+		if entryType(e) == recordPutTTL {
+			values[i] = ttlValue(e.ExpiresAt, e.Value)
+		}
+		size += 1 + 4 + 4 + 4 + len(e.Key) + len(values[i])
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, uint32(len(entries)))
+	off := 4
+
+	for i, e := range entries {
+		buf[off] = entryType(e)
+		off++
+
+		binary.BigEndian.PutUint32(buf[off:], e.CF)
+		off += 4
+
+		binary.BigEndian.PutUint32(buf[off:], uint32(len(e.Key)))
+		off += 4
+		binary.BigEndian.PutUint32(buf[off:], uint32(len(values[i])))
+		off += 4
+
+		copy(buf[off:], e.Key)
+		off += len(e.Key)
+		copy(buf[off:], values[i])
+		off += len(values[i])
+	}
+
+	return buf
+}
+
+// returns the record type of a batch entry.
+func entryType(e Entry) byte {
+	switch {
+	case e.RangeDelete:
+		return recordRangeDelete
+	case e.SingleDelete:
+		return recordSingleDelete
+	case e.Tombstone:
+		return recordDelete
+	case e.Merge:
+		return recordMerge
+	case e.ExpiresAt != 0:
+		return recordPutTTL
+	default:
+		return recordPut
+	}
+}
+
+// decodes a batch payload, assigning sequences from seq onwards.
+func (w *WAL) decodeBatch(seq uint64, buf []byte) ([]Entry, error) {
+	if len(buf) < 4 {
+		return nil, fmt.Errorf("wal: truncated batch record")
+	}
+
+	count := binary.BigEndian.Uint32(buf)
+	off := 4
+
+	var entries []Entry
+	for i := uint32(0); i < count; i++ {
+		if len(buf)-off < 1+4+4+4 {
+			return nil, fmt.Errorf("wal: truncated batch record")
+		}
+		typ := buf[off]
+		off++
+
+		cf := binary.BigEndian.Uint32(buf[off:])
+		off += 4
+
+		keyLen := int(binary.BigEndian.Uint32(buf[off:]))
+		off += 4
+		valLen := int(binary.BigEndian.Uint32(buf[off:]))
+		off += 4
+
+		if len(buf)-off < keyLen+valLen {
+			return nil, fmt.Errorf("wal: truncated batch record")
+		}
+
+		if err := w.checkLengths(typ, keyLen, valLen); err != nil {
+			return nil, err
+		}
+
+		e, err := decodeEntry(seq+uint64(i), typ, buf[off:off+keyLen], buf[off+keyLen:off+keyLen+valLen])
+		if err != nil {
+			return nil, err
+		}
+		e.CF = cf
+		entries = append(entries, e)
+		off += keyLen + valLen
+	}
+
+	return entries, nil
+}
+
 func (w *WAL) appendRecord(seq uint64, typ byte, key, value []byte) error {
+	if w.opts.ReadOnly {
+		return fmt.Errorf("wal: opened read-only")
+	}
+
 	buf := make([]byte, 8+4+4+1+len(key)+len(value))
 	off := 0
 
@@ -60,74 +359,275 @@ func (w *WAL) appendRecord(seq uint64, typ byte, key, value []byte) error {
 
 	copy(buf[off:], value)
 
+	w.opts.RateLimiter.Request(int64(len(buf)), ratelimit.High)
 	if _, err := w.file.Write(buf); err != nil {
 		return err
 	}
+	w.opts.Stats.Add(stats.WALBytes, uint64(len(buf)))
 
-	return w.file.Sync()
+	return w.Sync()
 }
 
 // represents a replayed WAL record.
+// For Merge entries Value holds the merge operand; for RangeDelete
+// entries Key and Value are the start and (exclusive) end of the range.
+// ExpiresAt is the expiry in unix nanoseconds (0 = never).
+// CF is the column family id (0 = default); only batches carry other ids.
 type Entry struct {
 	Seq       uint64
 	Key       []byte
 	Value     []byte
 	Tombstone bool
+	Merge     bool
+	ExpiresAt int64
+	CF        uint32
+
+	RangeDelete  bool
+	SingleDelete bool // Tombstone is also set
+}
+
+// PreparedTxn is a prepared transaction with no COMMIT or ROLLBACK record.
+type PreparedTxn struct {
+	Name    string
+	Entries []Entry
+}
+
+// Recovery is the state rebuilt from the WAL.
+type Recovery struct {
+	// writes with seq > fromSeq, in log order; committed prepared
+	// transactions appear at their COMMIT position
+	Entries []Entry
+
+	// prepared transactions that are still undecided, in prepare order
+	Prepared []PreparedTxn
+
+	// live column families (id → name) and the highest id ever created
+	ColumnFamilies    map[uint32]string
+	MaxColumnFamilyID uint32
+
+	// options recorded with the live column families (missing for column
+	// families created before options were recorded)
+	ColumnFamilyOptions map[uint32]ColumnFamilyOptions
+
+	// comparator name recorded at creation ("" if none was recorded)
+	Comparator string
+}
+
+// reads the next record, with avail bytes left in the log. It returns
+// io.EOF at the end of the log and io.ErrUnexpectedEOF for an incomplete
+// trailing record. Lengths are checked before anything is allocated.
+func (w *WAL) readRecord(avail int64) (seq uint64, typ byte, key, value []byte, err error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err = io.ReadFull(w.file, header); err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	seq = binary.BigEndian.Uint64(header)
+	keyLen := binary.BigEndian.Uint32(header[8:])
+	valLen := binary.BigEndian.Uint32(header[12:])
+	typ = header[16]
+
+	if int64(keyLen)+int64(valLen) > avail-recordHeaderSize {
+		return 0, 0, nil, nil, io.ErrUnexpectedEOF
+	}
+	if err = w.checkLengths(typ, int(keyLen), int(valLen)); err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	key = make([]byte, keyLen)
+	if _, err = io.ReadFull(w.file, key); err != nil {
+		return 0, 0, nil, nil, unexpectedEOF(err)
+	}
+
+	value = make([]byte, valLen)
+	if _, err = io.ReadFull(w.file, value); err != nil {
+		return 0, 0, nil, nil, unexpectedEOF(err)
+	}
+
+	return seq, typ, key, value, nil
+}
+
+// reports a record at off that cannot be decoded, or that runs off the end
+// of the log, as corruption. Other I/O errors are returned unchanged.
+func (w *WAL) corruption(off int64, err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+
+	reason := err.Error()
+	if err == io.ErrUnexpectedEOF {
+		reason = "truncated record"
+	}
+	return errs.Corruption(w.path, off, reason)
+}
+
+// refuses data record lengths beyond the configured limits.
+// Batch and prepare payloads hold many entries and are checked per entry;
+// metadata records (comparator, column family and transaction names) are
+// not user keys and are never limited.
+func (w *WAL) checkLengths(typ byte, keyLen, valLen int) error {
+	maxKey, maxValue := w.opts.MaxKeySize, w.opts.MaxValueSize
+
+	switch typ {
+	case recordRangeDelete:
+		maxValue = maxKey // the end key
+	case recordPutTTL:
+		if maxValue > 0 {
+			maxValue += 8
+		}
+	case recordMerge, recordPut:
+	case recordDelete, recordSingleDelete:
+		maxValue = 0
+	default:
+		return nil
+	}
+
+	if maxKey > 0 && keyLen > maxKey {
+		return fmt.Errorf("wal: key length %d exceeds limit %d", keyLen, maxKey)
+	}
+	if maxValue > 0 && valLen > maxValue {
+		return fmt.Errorf("wal: value length %d exceeds limit %d", valLen, maxValue)
+	}
+	return nil
+}
+
+// reports a clean EOF inside a record as io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
 
 // replays WAL records with seq > fromSeq.
 func (w *WAL) Replay(fromSeq uint64) ([]Entry, error) {
+	rec, err := w.Recover(fromSeq)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Entries, nil
+}
+
+// replays every WAL record, returning writes with seq > fromSeq together
+// with prepared transactions and column families.
+func (w *WAL) Recover(fromSeq uint64) (*Recovery, error) {
 	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
 		return nil, err
 	}
 
-	var entries []Entry
+	stat, err := w.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
 
-	for {
-		var seq uint64
-		if err := binary.Read(w.file, binary.BigEndian, &seq); err != nil {
-			if err == io.EOF {
-				break
-			}
-			return nil, err
-		}
+	rec := &Recovery{
+		ColumnFamilies:      make(map[uint32]string),
+		ColumnFamilyOptions: make(map[uint32]ColumnFamilyOptions),
+	}
 
-		var keyLen uint32
-		var valLen uint32
+	// start of the current record
+	var off int64
 
-		if err := binary.Read(w.file, binary.BigEndian, &keyLen); err != nil {
-			return nil, err
+	for {
+		seq, typ, key, value, err := w.readRecord(size - off)
+		if err == io.EOF {
+			break
 		}
-		if err := binary.Read(w.file, binary.BigEndian, &valLen); err != nil {
-			return nil, err
+		if err == io.ErrUnexpectedEOF && w.opts.ReadOnly {
+			break // the writer is still appending this record
 		}
-
-		typ := make([]byte, 1)
-		if _, err := io.ReadFull(w.file, typ); err != nil {
-			return nil, err
+		if err != nil {
+			return nil, w.corruption(off, err)
 		}
+		switch typ {
+		case recordPrepare:
+			batch, err := w.decodeBatch(0, value)
+			if err != nil {
+				return nil, w.corruption(off, err)
+			}
+			rec.Prepared = append(rec.Prepared, PreparedTxn{Name: string(key), Entries: batch})
 
-		key := make([]byte, keyLen)
-		if _, err := io.ReadFull(w.file, key); err != nil {
-			return nil, err
-		}
+		case recordCommit, recordRollback:
+			idx := -1
+			for i, p := range rec.Prepared {
+				if p.Name == string(key) {
+					idx = i
+					break
+				}
+			}
+			if idx < 0 {
+				return nil, w.corruption(off, fmt.Errorf("wal: decision for unknown prepared transaction %q", key))
+			}
 
-		value := make([]byte, valLen)
-		if _, err := io.ReadFull(w.file, value); err != nil {
-			return nil, err
-		}
+			if typ == recordCommit {
+				for i, e := range rec.Prepared[idx].Entries {
+					e.Seq = seq + uint64(i)
+					if e.Seq > fromSeq {
+						rec.Entries = append(rec.Entries, e)
+					}
+				}
+			}
+			rec.Prepared = append(rec.Prepared[:idx], rec.Prepared[idx+1:]...)
+
+		case recordCreateCF, recordDropCF:
+			// a create record may carry options after the id
+			if len(value) != 4 && (typ == recordDropCF || len(value) < 4+8) {
+				return nil, w.corruption(off, fmt.Errorf("wal: invalid column family record"))
+			}
+			id := binary.BigEndian.Uint32(value)
+			if typ == recordCreateCF {
+				rec.ColumnFamilies[id] = string(key)
+				if id > rec.MaxColumnFamilyID {
+					rec.MaxColumnFamilyID = id
+				}
+				if len(value) > 4 {
+					rec.ColumnFamilyOptions[id] = ColumnFamilyOptions{
+						MemtableSizeBytes: int64(binary.BigEndian.Uint64(value[4:])),
+						MergeOperator:     string(value[12:]),
+					}
+				}
+			} else {
+				delete(rec.ColumnFamilies, id)
+				delete(rec.ColumnFamilyOptions, id)
+			}
 
-		if seq > fromSeq {
-			entries = append(entries, Entry{
-				Seq:       seq,
-				Key:       key,
-				Value:     value,
-				Tombstone: typ[0] == recordDelete,
-			})
+		case recordComparator:
+			rec.Comparator = string(key)
+
+		case recordBatch:
+			batch, err := w.decodeBatch(seq, value)
+			if err != nil {
+				return nil, w.corruption(off, err)
+			}
+			for _, e := range batch {
+				if e.Seq > fromSeq {
+					rec.Entries = append(rec.Entries, e)
+				}
+			}
+
+		default:
+			e, err := decodeEntry(seq, typ, key, value)
+			if err != nil {
+				return nil, w.corruption(off, err)
+			}
+			if seq > fromSeq {
+				rec.Entries = append(rec.Entries, e)
+			}
 		}
+
+		off += int64(recordHeaderSize + len(key) + len(value))
 	}
 
-	return entries, nil
+	return rec, nil
+}
+
+// fsyncs the WAL file.
+func (w *WAL) Sync() error {
+	defer w.opts.Stats.Since(stats.WALSyncLatency, w.opts.Stats.Start())
+	w.opts.Stats.Add(stats.WALSyncs, 1)
+	return w.file.Sync()
 }
 
 // closes the WAL file.